@@ -1,18 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pmaene/p1_exporter/internal"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
-	"github.com/skoef/gop1"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -29,6 +32,68 @@ var (
 	p1USBDevice       string
 	p1Baudrate        int
 	p1Timeout         int
+	p1TariffNames     string
+	storagePath       string
+	storageInterval   time.Duration
+	costCurrency      string
+	costImportPrices  string
+	costExportPrices  string
+	costGasPrice      float64
+	costDynamicPrices string
+	homeWizardAddress string
+	mqttBrokerURL     string
+	mqttClientID      string
+	mqttUsername      string
+	mqttPassword      string
+	mqttTLSCAFile     string
+	mqttTLSCertFile   string
+	mqttTLSKeyFile    string
+	mqttTLSInsecure   bool
+	mqttTopicPrefix   string
+	mqttQoS           uint8
+	mqttRetain        bool
+	mqttFormat        string
+	mqttHADiscovery   bool
+	mqttHAPrefix      string
+
+	influxDBURL           string
+	influxDBOrg           string
+	influxDBBucket        string
+	influxDBToken         string
+	influxDBBatchSize     int
+	influxDBBufferSize    int
+	influxDBFlushInterval time.Duration
+
+	remoteWriteURL         string
+	remoteWriteUsername    string
+	remoteWritePassword    string
+	remoteWriteBearerToken string
+	remoteWriteHeaders     map[string]string
+	remoteWriteInterval    time.Duration
+	remoteWriteBatchSize   int
+	remoteWriteQueueSize   int
+
+	otlpEndpoint string
+	otlpProtocol string
+	otlpHeaders  map[string]string
+	otlpInterval time.Duration
+
+	splitterListenAddress string
+
+	smaEnabled      bool
+	smaAddress      string
+	smaSerialNumber uint32
+
+	modbusListenAddress string
+
+	csvPath     string
+	csvInterval time.Duration
+
+	historyPath             string
+	historyRetentionMinute  time.Duration
+	historyRetentionQuarter time.Duration
+	historyRetentionHour    time.Duration
+	historyRetentionDay     time.Duration
 
 	rootCmd = &cobra.Command{
 		Use:          "p1_exporter",
@@ -115,6 +180,384 @@ func init() {
 		"smart meter read timeout in milliseconds",
 	)
 
+	rootCmd.Flags().StringVar(
+		&p1TariffNames,
+		"p1.tariff-names",
+		"",
+		"comma-separated names for the electricity tariffs, e.g. 1:peak,2:offpeak",
+	)
+
+	rootCmd.Flags().StringVar(
+		&storagePath,
+		"storage.path",
+		"",
+		"directory in which to persist state across restarts",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&storageInterval,
+		"storage.interval",
+		time.Minute,
+		"interval at which to persist state",
+	)
+
+	rootCmd.Flags().StringVar(
+		&costCurrency,
+		"cost.currency",
+		"",
+		"currency of the configured prices, enables cost metrics",
+	)
+
+	rootCmd.Flags().StringVar(
+		&costImportPrices,
+		"cost.electricity-import-prices",
+		"",
+		"comma-separated price per kWh delivered for each tariff, e.g. 1:0.30,2:0.25",
+	)
+
+	rootCmd.Flags().StringVar(
+		&costExportPrices,
+		"cost.electricity-export-prices",
+		"",
+		"comma-separated price per kWh injected for each tariff, e.g. 1:0.05,2:0.05",
+	)
+
+	rootCmd.Flags().Float64Var(
+		&costGasPrice,
+		"cost.gas-price",
+		0,
+		"price per cubic meter of gas delivered",
+	)
+
+	rootCmd.Flags().StringVar(
+		&costDynamicPrices,
+		"cost.dynamic-prices-file",
+		"",
+		"CSV or JSON file with dynamic electricity prices, overriding the tariff prices",
+	)
+
+	rootCmd.Flags().StringVar(
+		&homeWizardAddress,
+		"homewizard.listen-address",
+		"",
+		"address on which to emulate the HomeWizard P1 meter API, e.g. :80",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttBrokerURL,
+		"mqtt.broker-url",
+		"",
+		"URL of the MQTT broker to publish readings to, e.g. tcp://localhost:1883",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttClientID,
+		"mqtt.client-id",
+		"p1_exporter",
+		"client identifier to connect to the MQTT broker with",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttUsername,
+		"mqtt.username",
+		"",
+		"username to authenticate to the MQTT broker with",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttPassword,
+		"mqtt.password",
+		"",
+		"password to authenticate to the MQTT broker with",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttTLSCAFile,
+		"mqtt.tls-ca-file",
+		"",
+		"CA certificate to verify the MQTT broker with",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttTLSCertFile,
+		"mqtt.tls-cert-file",
+		"",
+		"client certificate to authenticate to the MQTT broker with",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttTLSKeyFile,
+		"mqtt.tls-key-file",
+		"",
+		"private key of the client certificate",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&mqttTLSInsecure,
+		"mqtt.tls-insecure-skip-verify",
+		false,
+		"skip verification of the MQTT broker's certificate",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttTopicPrefix,
+		"mqtt.topic-prefix",
+		"p1",
+		"prefix of the MQTT topics to publish to",
+	)
+
+	rootCmd.Flags().Uint8Var(
+		&mqttQoS,
+		"mqtt.qos",
+		0,
+		"MQTT quality of service level to publish with",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&mqttRetain,
+		"mqtt.retain",
+		false,
+		"whether the MQTT broker should retain published readings",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttFormat,
+		"mqtt.format",
+		string(internal.MQTTFormatFields),
+		"publish readings as one topic per field, as JSON, or both (fields, json, both)",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&mqttHADiscovery,
+		"mqtt.homeassistant-discovery",
+		false,
+		"publish Home Assistant discovery messages, implies publishing one topic per field",
+	)
+
+	rootCmd.Flags().StringVar(
+		&mqttHAPrefix,
+		"mqtt.homeassistant-prefix",
+		"homeassistant",
+		"topic prefix of Home Assistant's MQTT discovery",
+	)
+
+	rootCmd.Flags().StringVar(
+		&influxDBURL,
+		"influxdb.url",
+		"",
+		"URL of the InfluxDB server to write readings to, e.g. http://localhost:8086",
+	)
+
+	rootCmd.Flags().StringVar(
+		&influxDBOrg,
+		"influxdb.org",
+		"",
+		"InfluxDB organization",
+	)
+
+	rootCmd.Flags().StringVar(
+		&influxDBBucket,
+		"influxdb.bucket",
+		"p1",
+		"InfluxDB bucket",
+	)
+
+	rootCmd.Flags().StringVar(
+		&influxDBToken,
+		"influxdb.token",
+		"",
+		"InfluxDB API token",
+	)
+
+	rootCmd.Flags().IntVar(
+		&influxDBBatchSize,
+		"influxdb.batch-size",
+		500,
+		"maximum number of lines per write",
+	)
+
+	rootCmd.Flags().IntVar(
+		&influxDBBufferSize,
+		"influxdb.buffer-size",
+		100000,
+		"maximum number of lines buffered while InfluxDB is unavailable",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&influxDBFlushInterval,
+		"influxdb.flush-interval",
+		10*time.Second,
+		"interval at which buffered lines are written",
+	)
+
+	rootCmd.Flags().StringVar(
+		&remoteWriteURL,
+		"remote-write.url",
+		"",
+		"Prometheus remote-write endpoint to push metrics to",
+	)
+
+	rootCmd.Flags().StringVar(
+		&remoteWriteUsername,
+		"remote-write.username",
+		"",
+		"username for basic authentication",
+	)
+
+	rootCmd.Flags().StringVar(
+		&remoteWritePassword,
+		"remote-write.password",
+		"",
+		"password for basic authentication",
+	)
+
+	rootCmd.Flags().StringVar(
+		&remoteWriteBearerToken,
+		"remote-write.bearer-token",
+		"",
+		"bearer token for authentication",
+	)
+
+	rootCmd.Flags().StringToStringVar(
+		&remoteWriteHeaders,
+		"remote-write.headers",
+		nil,
+		"additional headers, e.g. X-Scope-OrgID=tenant",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&remoteWriteInterval,
+		"remote-write.interval",
+		15*time.Second,
+		"interval at which metrics are gathered and pushed",
+	)
+
+	rootCmd.Flags().IntVar(
+		&remoteWriteBatchSize,
+		"remote-write.batch-size",
+		2000,
+		"maximum number of samples per request",
+	)
+
+	rootCmd.Flags().IntVar(
+		&remoteWriteQueueSize,
+		"remote-write.queue-size",
+		500000,
+		"maximum number of samples queued while the endpoint is unavailable",
+	)
+
+	rootCmd.Flags().StringVar(
+		&otlpEndpoint,
+		"otlp.endpoint",
+		"",
+		"OTLP endpoint to export metrics to, e.g. http://localhost:4318/v1/metrics",
+	)
+
+	rootCmd.Flags().StringVar(
+		&otlpProtocol,
+		"otlp.protocol",
+		"http",
+		"OTLP transport protocol (http, grpc)",
+	)
+
+	rootCmd.Flags().StringToStringVar(
+		&otlpHeaders,
+		"otlp.headers",
+		nil,
+		"additional headers, e.g. Authorization=Bearer token",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&otlpInterval,
+		"otlp.interval",
+		15*time.Second,
+		"interval at which metrics are exported",
+	)
+
+	rootCmd.Flags().StringVar(
+		&splitterListenAddress,
+		"splitter.listen-address",
+		"",
+		"address on which to forward raw telegrams to TCP clients, e.g. :2001",
+	)
+
+	rootCmd.Flags().BoolVar(
+		&smaEnabled,
+		"sma.enabled",
+		false,
+		"emulate an SMA Energy Meter over Speedwire",
+	)
+
+	rootCmd.Flags().StringVar(
+		&smaAddress,
+		"sma.address",
+		"239.12.255.254:9522",
+		"address to which the Speedwire datagrams are sent",
+	)
+
+	rootCmd.Flags().Uint32Var(
+		&smaSerialNumber,
+		"sma.serial-number",
+		0,
+		"serial number of the emulated energy meter, derived from the equipment identifier if zero",
+	)
+
+	rootCmd.Flags().StringVar(
+		&modbusListenAddress,
+		"modbus.listen-address",
+		"",
+		"address on which to serve readings as a SunSpec meter over Modbus TCP, e.g. :502",
+	)
+
+	rootCmd.Flags().StringVar(
+		&csvPath,
+		"csv.path",
+		"",
+		"directory in which to write a CSV file with readings per day",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&csvInterval,
+		"csv.interval",
+		0,
+		"minimum interval between CSV rows, every telegram is written if zero",
+	)
+
+	rootCmd.Flags().StringVar(
+		&historyPath,
+		"history.path",
+		"",
+		"path of the SQLite database in which to store history",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&historyRetentionMinute,
+		"history.retention-1m",
+		366*24*time.Hour,
+		"retention of the per-minute history, kept forever if zero",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&historyRetentionQuarter,
+		"history.retention-15m",
+		0,
+		"retention of the per-quarter-hour history, kept forever if zero",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&historyRetentionHour,
+		"history.retention-1h",
+		0,
+		"retention of the hourly history, kept forever if zero",
+	)
+
+	rootCmd.Flags().DurationVar(
+		&historyRetentionDay,
+		"history.retention-1d",
+		0,
+		"retention of the daily history, kept forever if zero",
+	)
+
 	if err := viper.BindPFlags(rootCmd.Flags()); err != nil {
 		log.Fatal(err)
 	}
@@ -131,8 +574,12 @@ func initConfig() {
 func runRoot(cmd *cobra.Command, args []string) {
 	log.Infoln("starting", cmd.Name(), cmd.Version)
 
-	p1, err := gop1.New(
-		gop1.P1Config{
+	// Sinks which hold on to data register themselves here, to persist or
+	// flush it when the exporter is stopped.
+	var shutdown []func()
+
+	p1, err := internal.NewReader(
+		internal.ReaderConfig{
 			USBDevice: viper.GetString("p1.usb-device"),
 			Baudrate:  viper.GetInt("p1.baudrate"),
 			Timeout:   viper.GetInt("p1.timeout"),
@@ -143,36 +590,167 @@ func runRoot(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 
-	s := internal.NewP1State(log.Base(), p1)
+	var st *internal.Storage
+	if viper.GetString("storage.path") != "" {
+		st, err = internal.NewStorage(
+			viper.GetString("storage.path"),
+			viper.GetDuration("storage.interval"),
+		)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var pr *internal.Prices
+	if viper.GetString("cost.currency") != "" {
+		pr, err = newPrices()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if pr.Dynamic != nil {
+			go pr.Dynamic.Start()
+		}
+	}
+
+	s := internal.NewP1State(log.Base(), p1, st, pr)
 	go s.Start()
 
-	c := internal.NewCollector(s)
+	shutdown = append(shutdown, s.Shutdown)
+
+	n, err := internal.ParseTariffNames(viper.GetString("p1.tariff-names"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c := internal.NewCollector(s, n)
 	if err := prometheus.Register(c); err != nil {
 		log.Fatal(err)
 	}
 
+	if viper.GetString("remote-write.url") != "" {
+		w, err := newRemoteWriter(c, st)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := prometheus.Register(w); err != nil {
+			log.Fatal(err)
+		}
+
+		go w.Start()
+	}
+
 	http.Handle(
 		viper.GetString("web.telemetry-path"),
 		promhttp.Handler(),
 	)
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write(
-			[]byte(
-				`<html>
-				<head><title>P1 Exporter</title></head>
-				<body>
-				<h1>P1 Exporter</h1>
-				<p><a href='/metrics'>Metrics</a></p>
-				</body>
-				</html>`,
-			),
+	a := internal.NewAPI(s, n)
+	http.HandleFunc("/api/v1/snapshot", a.ServeSnapshot)
+	http.HandleFunc("/api/v1/stream", a.ServeStream)
+	http.HandleFunc("/api/v1/errors", a.ServeErrors)
+
+	if viper.GetString("history.path") != "" {
+		h, err := newHistory(s, n)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		http.HandleFunc("/api/v1/history", h.ServeHistory)
+		go h.Start()
+		shutdown = append(shutdown, h.Shutdown)
+	}
+
+	d := internal.NewDashboard(s, viper.GetString("web.telemetry-path"))
+	http.HandleFunc("/debug/telegram", d.ServeTelegram)
+	http.HandleFunc("/", d.ServeDashboard)
+
+	if viper.GetString("mqtt.broker-url") != "" {
+		p, err := newMQTTPublisher(s, n)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go p.Start()
+	}
+
+	if viper.GetString("influxdb.url") != "" {
+		w, err := internal.NewInfluxDBWriter(
+			log.Base(),
+			s,
+			n,
+			internal.InfluxDBConfig{
+				URL:           viper.GetString("influxdb.url"),
+				Org:           viper.GetString("influxdb.org"),
+				Bucket:        viper.GetString("influxdb.bucket"),
+				Token:         viper.GetString("influxdb.token"),
+				BatchSize:     viper.GetInt("influxdb.batch-size"),
+				BufferSize:    viper.GetInt("influxdb.buffer-size"),
+				FlushInterval: viper.GetDuration("influxdb.flush-interval"),
+			},
+		)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go w.Start()
+	}
+
+	if viper.GetString("csv.path") != "" {
+		w, err := internal.NewCSVWriter(
+			log.Base(),
+			s,
+			n,
+			internal.CSVConfig{
+				Path:     viper.GetString("csv.path"),
+				Interval: viper.GetDuration("csv.interval"),
+			},
 		)
 
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			log.Fatal(err)
+		}
+
+		go w.Start()
+	}
+
+	if viper.GetString("otlp.endpoint") != "" {
+		e, err := newOTLPExporter(s, n)
+		if err != nil {
+			log.Fatal(err)
 		}
-	})
+
+		go e.Start()
+		shutdown = append(shutdown, e.Shutdown)
+	}
+
+	if viper.GetString("homewizard.listen-address") != "" {
+		go serveHomeWizard(s)
+	}
+
+	if viper.GetBool("sma.enabled") {
+		e := internal.NewSpeedwireEmitter(
+			log.Base(),
+			s,
+			internal.SpeedwireConfig{
+				Address:      viper.GetString("sma.address"),
+				SerialNumber: viper.GetUint32("sma.serial-number"),
+			},
+		)
+
+		go e.Start()
+	}
+
+	if viper.GetString("splitter.listen-address") != "" {
+		go serveSplitter(s)
+	}
+
+	if viper.GetString("modbus.listen-address") != "" {
+		go serveModbus(s)
+	}
 
 	srv := http.Server{
 		ReadHeaderTimeout: viper.GetDuration("web.read-header-timeout"),
@@ -187,8 +765,245 @@ func runRoot(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
 	log.Infoln("listening on", viper.GetString("web.listen-address"))
+	if err := srv.Serve(lst); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+
+	log.Infoln("shutting down")
+	for _, f := range shutdown {
+		f()
+	}
+}
+
+func newPrices() (*internal.Prices, error) {
+	im, err := internal.ParseTariffPrices(
+		viper.GetString("cost.electricity-import-prices"),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ex, err := internal.ParseTariffPrices(
+		viper.GetString("cost.electricity-export-prices"),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &internal.Prices{
+		Currency:          viper.GetString("cost.currency"),
+		ElectricityImport: im,
+		ElectricityExport: ex,
+		Gas:               viper.GetFloat64("cost.gas-price"),
+	}
+
+	// The gas cost is a counter, so it can't decrease.
+	if pr.Gas < 0 {
+		return nil, internal.ErrInvalidGasPrice
+	}
+
+	if viper.GetString("cost.dynamic-prices-file") != "" {
+		pr.Dynamic, err = internal.LoadDynamicPrices(
+			log.Base(),
+			viper.GetString("cost.dynamic-prices-file"),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pr, nil
+}
+
+func newMQTTPublisher(
+	s *internal.P1State,
+	n internal.TariffNames,
+) (*internal.MQTTPublisher, error) {
+	f, err := internal.ParseMQTTFormat(viper.GetString("mqtt.format"))
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := internal.ParseMQTTQoS(viper.GetUint("mqtt.qos"))
+	if err != nil {
+		return nil, err
+	}
+
+	return internal.NewMQTTPublisher(
+		log.Base(),
+		s,
+		n,
+		internal.MQTTConfig{
+			BrokerURL:              viper.GetString("mqtt.broker-url"),
+			ClientID:               viper.GetString("mqtt.client-id"),
+			Username:               viper.GetString("mqtt.username"),
+			Password:               viper.GetString("mqtt.password"),
+			TLSCAFile:              viper.GetString("mqtt.tls-ca-file"),
+			TLSCertFile:            viper.GetString("mqtt.tls-cert-file"),
+			TLSKeyFile:             viper.GetString("mqtt.tls-key-file"),
+			TLSInsecureSkipVerify:  viper.GetBool("mqtt.tls-insecure-skip-verify"),
+			TopicPrefix:            viper.GetString("mqtt.topic-prefix"),
+			QoS:                    q,
+			Retain:                 viper.GetBool("mqtt.retain"),
+			Format:                 f,
+			HomeAssistantDiscovery: viper.GetBool("mqtt.homeassistant-discovery"),
+			HomeAssistantPrefix:    viper.GetString("mqtt.homeassistant-prefix"),
+		},
+	)
+}
+
+func newRemoteWriter(
+	c *internal.Collector,
+	st *internal.Storage,
+) (*internal.RemoteWriter, error) {
+	r := prometheus.NewRegistry()
+	w, err := internal.NewRemoteWriter(
+		log.Base(),
+		r,
+		st,
+		internal.RemoteWriteConfig{
+			URL:         viper.GetString("remote-write.url"),
+			Username:    viper.GetString("remote-write.username"),
+			Password:    viper.GetString("remote-write.password"),
+			BearerToken: viper.GetString("remote-write.bearer-token"),
+			Headers:     viper.GetStringMapString("remote-write.headers"),
+			Interval:    viper.GetDuration("remote-write.interval"),
+			BatchSize:   viper.GetInt("remote-write.batch-size"),
+			QueueSize:   viper.GetInt("remote-write.queue-size"),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The writer's own metrics are pushed as well, the meter can't be scraped.
+	r.MustRegister(c, w)
+	return w, nil
+}
+
+func newHistory(
+	s *internal.P1State,
+	n internal.TariffNames,
+) (*internal.History, error) {
+	return internal.NewHistory(
+		log.Base(),
+		s,
+		n,
+		internal.HistoryConfig{
+			Path: viper.GetString("history.path"),
+			Retention: map[string]time.Duration{
+				"1m":  viper.GetDuration("history.retention-1m"),
+				"15m": viper.GetDuration("history.retention-15m"),
+				"1h":  viper.GetDuration("history.retention-1h"),
+				"1d":  viper.GetDuration("history.retention-1d"),
+			},
+		},
+	)
+}
+
+func newOTLPExporter(
+	s *internal.P1State,
+	n internal.TariffNames,
+) (*internal.OTLPExporter, error) {
+	p, err := internal.ParseOTLPProtocol(viper.GetString("otlp.protocol"))
+	if err != nil {
+		return nil, err
+	}
+
+	return internal.NewOTLPExporter(
+		log.Base(),
+		s,
+		n,
+		internal.OTLPConfig{
+			Endpoint: viper.GetString("otlp.endpoint"),
+			Protocol: p,
+			Headers:  viper.GetStringMapString("otlp.headers"),
+			Interval: viper.GetDuration("otlp.interval"),
+			Version:  GetVersion(),
+		},
+	)
+}
+
+func serveHomeWizard(s *internal.P1State) {
+	srv := http.Server{
+		Handler:           internal.NewHomeWizardAPI(s, GetVersion()).Handler(),
+		ReadHeaderTimeout: viper.GetDuration("web.read-header-timeout"),
+	}
+
+	lst, err := net.Listen(
+		"tcp",
+		viper.GetString("homewizard.listen-address"),
+	)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infoln(
+		"emulating HomeWizard P1 meter on",
+		viper.GetString("homewizard.listen-address"),
+	)
+
 	if err := srv.Serve(lst); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func serveSplitter(s *internal.P1State) {
+	lst, err := net.Listen(
+		"tcp",
+		viper.GetString("splitter.listen-address"),
+	)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infoln(
+		"forwarding telegrams on",
+		viper.GetString("splitter.listen-address"),
+	)
+
+	if err := internal.NewSplitter(log.Base(), s).Serve(lst); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serveModbus(s *internal.P1State) {
+	lst, err := net.Listen(
+		"tcp",
+		viper.GetString("modbus.listen-address"),
+	)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infoln(
+		"serving Modbus TCP on",
+		viper.GetString("modbus.listen-address"),
+	)
+
+	m := internal.NewModbusServer(log.Base(), s, GetVersion())
+	if err := m.Serve(lst); err != nil {
+		log.Fatal(err)
+	}
+}
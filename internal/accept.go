@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+const maxAcceptDelay = time.Second
+
+// accept calls serve in a new goroutine for every connection accepted on l.
+// Temporary errors, like running out of file descriptors, are retried with an
+// increasing delay like net/http does, other errors are returned.
+func accept(lg log.Logger, l net.Listener, serve func(net.Conn)) error {
+	var d time.Duration
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				if d == 0 {
+					d = 5 * time.Millisecond
+				} else {
+					d *= 2
+				}
+
+				d = min(d, maxAcceptDelay)
+
+				lg.Warnf("accept error: %v; retrying in %v", err, d)
+				time.Sleep(d)
+				continue
+			}
+
+			return err
+		}
+
+		d = 0
+		go serve(c)
+	}
+}
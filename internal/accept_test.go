@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+// testListener returns the connections and errors it was given in order.
+type testListener struct {
+	net.Listener
+
+	conns []net.Conn
+	errs  []error
+}
+
+func (l *testListener) Accept() (net.Conn, error) {
+	c, err := l.conns[0], l.errs[0]
+	l.conns, l.errs = l.conns[1:], l.errs[1:]
+
+	return c, err
+}
+
+func TestAccept(t *testing.T) {
+	c, _ := net.Pipe()
+	l := &testListener{
+		conns: []net.Conn{nil, c, nil},
+		errs: []error{
+			&net.OpError{Op: "accept", Err: syscall.EMFILE},
+			nil,
+			net.ErrClosed,
+		},
+	}
+
+	err := accept(log.Base(), l, func(c net.Conn) { c.Close() })
+	if !errors.Is(err, net.ErrClosed) {
+		t.Errorf("accept() error = %v, want %v", err, net.ErrClosed)
+	}
+
+	if len(l.errs) != 0 {
+		t.Errorf("accept() returned before the listener was closed")
+	}
+}
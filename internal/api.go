@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type quantity struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+func quantities[K comparable, V ~float64](m map[K]V, f func(K) string, u string) map[string]quantity {
+	r := make(map[string]quantity, len(m))
+	for k, v := range m {
+		r[f(k)] = quantity{Value: float64(v), Unit: u}
+	}
+
+	return r
+}
+
+type meterResponse struct {
+	Manufacturer           string `json:"manufacturer"`
+	ManufacturerCode       string `json:"manufacturer_code"`
+	Model                  string `json:"model"`
+	DSMRVersion            string `json:"dsmr_version"`
+	EquipmentIdentifier    string `json:"equipment_id"`
+	GasEquipmentIdentifier string `json:"gas_equipment_id"`
+}
+
+type electricityResponse struct {
+	PowerDelivered      quantity            `json:"power_delivered"`
+	PowerInjected       quantity            `json:"power_injected"`
+	PowerNet            quantity            `json:"power_net"`
+	Delivered           map[string]quantity `json:"delivered"`
+	Injected            map[string]quantity `json:"injected"`
+	Net                 quantity            `json:"net"`
+	Current             map[string]quantity `json:"current"`
+	Voltage             map[string]quantity `json:"voltage"`
+	ApparentPower       map[string]quantity `json:"apparent_power"`
+	Tariff              string              `json:"tariff"`
+	BreakerState        *string             `json:"breaker_state"`
+	LimiterThreshold    quantity            `json:"limiter_threshold"`
+	FuseThreshold       map[string]quantity `json:"fuse_threshold"`
+	Demand              quantity            `json:"demand"`
+	DemandPeak          quantity            `json:"demand_peak"`
+	DemandPeakTimestamp *time.Time          `json:"demand_peak_timestamp"`
+}
+
+type gasResponse struct {
+	Delivered          quantity   `json:"delivered"`
+	DeliveredTimestamp *time.Time `json:"delivered_timestamp"`
+	FlowRate           quantity   `json:"flow_rate"`
+	ValveState         *string    `json:"valve_state"`
+}
+
+type costResponse struct {
+	Currency           string             `json:"currency"`
+	Electricity        map[string]float64 `json:"electricity"`
+	ElectricityRevenue map[string]float64 `json:"electricity_revenue"`
+	Gas                float64            `json:"gas"`
+}
+
+type periodResponse struct {
+	Delivered map[string]quantity `json:"delivered"`
+	Injected  map[string]quantity `json:"injected"`
+	Gas       quantity            `json:"gas"`
+}
+
+type stateChangeResponse struct {
+	Timestamp time.Time `json:"timestamp"`
+	Device    string    `json:"device"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+}
+
+type snapshotResponse struct {
+	Up                bool                      `json:"up"`
+	Restored          bool                      `json:"restored"`
+	Timestamp         *time.Time                `json:"timestamp"`
+	MeterTimestamp    *time.Time                `json:"meter_timestamp"`
+	ReceivedTimestamp *time.Time                `json:"received_timestamp"`
+	Meter             meterResponse             `json:"meter"`
+	Electricity       electricityResponse       `json:"electricity"`
+	Gas               gasResponse               `json:"gas"`
+	Periods           map[string]periodResponse `json:"periods"`
+	Cost              *costResponse             `json:"cost,omitempty"`
+	StateChanges      []stateChangeResponse     `json:"state_changes,omitempty"`
+}
+
+type errorResponse struct {
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+type API struct {
+	P1State     *P1State
+	TariffNames TariffNames
+}
+
+func (a *API) ServeSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, newSnapshotResponse(a.P1State.Snapshot(), a.TariffNames))
+}
+
+func (a *API) ServeErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	es := a.P1State.Errors()
+
+	v := make([]errorResponse, 0, len(es))
+	for i := len(es) - 1; i >= 0; i-- {
+		v = append(v, errorResponse{
+			Timestamp: es[i].Timestamp,
+			Message:   es[i].Message,
+		})
+	}
+
+	writeJSON(w, v)
+}
+
+func NewAPI(s *P1State, n TariffNames) *API {
+	return &API{
+		P1State:     s,
+		TariffNames: n,
+	}
+}
+
+func newSnapshotResponse(s Snapshot, n TariffNames) snapshotResponse {
+	phase := func(k string) string { return k }
+
+	v := snapshotResponse{
+		Up:                s.Up(),
+		Restored:          s.Restored,
+		Timestamp:         optionalTime(s.Timestamp),
+		MeterTimestamp:    optionalTime(s.MeterTimestamp),
+		ReceivedTimestamp: optionalTime(s.ReceivedTimestamp),
+		Meter: meterResponse{
+			Manufacturer:           s.Header.Manufacturer.Name,
+			ManufacturerCode:       s.Header.Manufacturer.Code,
+			Model:                  s.Header.Model,
+			DSMRVersion:            s.Version.String(),
+			EquipmentIdentifier:    s.EquipmentIdentifier,
+			GasEquipmentIdentifier: s.GasEquipmentIdentifier,
+		},
+		Electricity: electricityResponse{
+			PowerDelivered:      quantity{float64(s.ElectricPowerDelivered), "W"},
+			PowerInjected:       quantity{float64(s.ElectricPowerInjected), "W"},
+			PowerNet:            quantity{float64(s.ElectricPowerNet()), "W"},
+			Delivered:           quantities(s.TotalElectricityDelivered, n.Name, "Wh"),
+			Injected:            quantities(s.TotalElectricityInjected, n.Name, "Wh"),
+			Net:                 quantity{float64(s.TotalElectricityNet()), "Wh"},
+			Current:             quantities(s.ElectricCurrent, phase, "A"),
+			Voltage:             quantities(s.Voltage, phase, "V"),
+			ApparentPower:       quantities(s.ApparentPower(), phase, "VA"),
+			Tariff:              n.Name(s.ElectricityTariffIndicator),
+			BreakerState:        optionalState(s.BreakerStateObserved, s.BreakerState),
+			LimiterThreshold:    quantity{float64(s.ElectricityLimiterThreshold), "W"},
+			FuseThreshold:       quantities(s.FuseThreshold, phase, "A"),
+			Demand:              quantity{float64(s.ElectricityDemand), "W"},
+			DemandPeak:          quantity{float64(s.ElectricityDemandPeak), "W"},
+			DemandPeakTimestamp: optionalTime(s.ElectricityDemandPeakTime),
+		},
+		Gas: gasResponse{
+			Delivered:          quantity{float64(s.TotalGasDelivered), "m3"},
+			DeliveredTimestamp: optionalTime(s.TotalGasDeliveredTimestamp),
+			FlowRate:           quantity{float64(s.GasFlowRate), "m3/h"},
+			ValveState:         optionalState(s.GasValveStateObserved, s.GasValveState),
+		},
+	}
+
+	v.Periods = make(map[string]periodResponse, len(s.Periods))
+	for k, p := range s.Periods {
+		v.Periods[k] = periodResponse{
+			Delivered: quantities(p.Delivered, n.Name, "Wh"),
+			Injected:  quantities(p.Injected, n.Name, "Wh"),
+			Gas:       quantity{float64(p.Gas), "m3"},
+		}
+	}
+
+	for _, c := range s.StateChanges {
+		v.StateChanges = append(v.StateChanges, stateChangeResponse(c))
+	}
+
+	if s.Currency != "" {
+		cost := func(m map[int]float64) map[string]float64 {
+			r := make(map[string]float64, len(m))
+			for k, v := range m {
+				r[n.Name(k)] = v
+			}
+
+			return r
+		}
+
+		v.Cost = &costResponse{
+			Currency:           s.Currency,
+			Electricity:        cost(s.ElectricityCost),
+			ElectricityRevenue: cost(s.ElectricityRevenue),
+			Gas:                s.GasCost,
+		}
+	}
+
+	return v
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func optionalState(observed bool, v fmt.Stringer) *string {
+	if !observed {
+		return nil
+	}
+
+	s := v.String()
+	return &s
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+// testTelegram is a telegram from a Kaifa meter with a gas meter attached.
+const testTelegram = "/KFM5KAIFA-METER\r\n" +
+	"\r\n" +
+	"1-3:0.2.8(42)\r\n" +
+	"0-0:1.0.0(210204163628W)\r\n" +
+	"0-0:96.1.1(4B464D303031)\r\n" +
+	"1-0:1.8.1(000123.456*kWh)\r\n" +
+	"1-0:1.8.2(000200.000*kWh)\r\n" +
+	"0-0:96.14.0(0002)\r\n" +
+	"1-0:1.7.0(00.500*kW)\r\n" +
+	"0-1:96.1.0(3232323241424344)\r\n" +
+	"0-1:24.2.1(210204160000W)(00042.000*m3)\r\n" +
+	"!1234\r\n"
+
+func TestAPIServeSnapshot(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+	if err := s.handleTelegram(ParseTelegram(testTelegram)); err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	a := NewAPI(s, TariffNames{1: "offpeak", 2: "peak"})
+
+	t.Run("get", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		a.ServeSnapshot(w, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+
+		if v := w.Header().Get("Content-Type"); v != "application/json" {
+			t.Errorf("Content-Type = %q, want %q", v, "application/json")
+		}
+
+		var r snapshotResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		if r.Meter.EquipmentIdentifier != "KFM001" {
+			t.Errorf("EquipmentIdentifier = %q, want %q", r.Meter.EquipmentIdentifier, "KFM001")
+		}
+
+		if r.Meter.GasEquipmentIdentifier != "2222ABCD" {
+			t.Errorf("GasEquipmentIdentifier = %q, want %q", r.Meter.GasEquipmentIdentifier, "2222ABCD")
+		}
+
+		if v := r.Electricity.Delivered["peak"].Value; v != 200000 {
+			t.Errorf("Delivered[peak] = %v, want 200000", v)
+		}
+
+		if r.Electricity.Tariff != "peak" {
+			t.Errorf("Tariff = %q, want %q", r.Electricity.Tariff, "peak")
+		}
+	})
+
+	t.Run("post", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		a.ServeSnapshot(w, httptest.NewRequest(http.MethodPost, "/api/v1/snapshot", nil))
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+		}
+
+		if v := w.Header().Get("Allow"); v != http.MethodGet {
+			t.Errorf("Allow = %q, want %q", v, http.MethodGet)
+		}
+	})
+}
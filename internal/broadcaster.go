@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"sync"
+)
+
+// Broadcaster fans values out to any number of subscribers. Publishing never
+// blocks: subscribers which can't keep up only receive the most recent value.
+type Broadcaster[T any] struct {
+	mutex       sync.Mutex
+	subscribers map[<-chan T]chan T
+}
+
+func (b *Broadcaster[T]) Subscribe() <-chan T {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[<-chan T]chan T)
+	}
+
+	c := make(chan T, 1)
+	b.subscribers[c] = c
+
+	return c
+}
+
+func (b *Broadcaster[T]) Unsubscribe(c <-chan T) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.subscribers, c)
+}
+
+func (b *Broadcaster[T]) Publish(v T) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, c := range b.subscribers {
+		select {
+		case c <- v:
+			continue
+		default:
+		}
+
+		// Drop the value the subscriber hasn't consumed yet to make room.
+		select {
+		case <-c:
+		default:
+		}
+
+		c <- v
+	}
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitSubscribers waits until n subscribers are subscribed to b.
+func waitSubscribers[T any](t *testing.T, b *Broadcaster[T], n int) {
+	t.Helper()
+
+	for d := time.Now().Add(5 * time.Second); time.Now().Before(d); {
+		b.mutex.Lock()
+		v := len(b.subscribers)
+		b.mutex.Unlock()
+
+		if v == n {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("subscribers != %d", n)
+}
+
+func TestBroadcasterPublish(t *testing.T) {
+	var b Broadcaster[int]
+
+	fast := b.Subscribe()
+	slow := b.Subscribe()
+
+	for i := 1; i <= 3; i++ {
+		b.Publish(i)
+		if v := <-fast; v != i {
+			t.Errorf("fast subscriber received %d, want %d", v, i)
+		}
+	}
+
+	// The slow subscriber only receives the most recent value.
+	if v := <-slow; v != 3 {
+		t.Errorf("slow subscriber received %d, want 3", v)
+	}
+
+	select {
+	case v := <-slow:
+		t.Errorf("slow subscriber received %d, want nothing", v)
+	default:
+	}
+
+	b.Unsubscribe(fast)
+	b.Publish(4)
+
+	select {
+	case v := <-fast:
+		t.Errorf("unsubscribed subscriber received %d", v)
+	default:
+	}
+
+	if v := <-slow; v != 4 {
+		t.Errorf("slow subscriber received %d, want 4", v)
+	}
+}
+
+func TestBroadcasterUnsubscribeWhilePublishing(t *testing.T) {
+	var b Broadcaster[int]
+
+	done := make(chan struct{})
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				b.Publish(i)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			c := b.Subscribe()
+			<-c
+			b.Unsubscribe(c)
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	<-published
+
+	waitSubscribers(t, &b, 0)
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	checkpointName = "state.json"
+
+	// legacyDemandName held the month's demand peak before it became part of
+	// the checkpoint.
+	legacyDemandName = "demand.json"
+)
+
+type legacyDemand struct {
+	Peak      Power     `json:"peak"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type checkpoint struct {
+	Snapshot            Snapshot      `json:"snapshot"`
+	TimestampDifference time.Duration `json:"timestamp_difference"`
+	MeterTimestamp      time.Time     `json:"meter_timestamp"`
+	GasFlowMeter        flowMeter     `json:"gas_flow_meter"`
+	Demand              demandTracker `json:"demand"`
+	Cost                costTracker   `json:"cost"`
+	Periods             periodTracker `json:"periods"`
+}
+
+func (s *P1State) checkpoints() {
+	t := time.NewTicker(s.Storage.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-s.checkpointRequests:
+		}
+
+		if err := s.checkpoint(); err != nil {
+			s.recordError(err)
+		}
+	}
+}
+
+// requestCheckpoint checkpoints without waiting for the next interval, for
+// changes which can't be recomputed after a crash.
+func (s *P1State) requestCheckpoint() {
+	if s.Storage == nil {
+		return
+	}
+
+	select {
+	case s.checkpointRequests <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown saves a final checkpoint, so that nothing since the last interval
+// is lost when the exporter is stopped.
+func (s *P1State) Shutdown() {
+	if s.Storage == nil {
+		return
+	}
+
+	if err := s.checkpoint(); err != nil {
+		s.recordError(err)
+	}
+}
+
+func (s *P1State) checkpoint() error {
+	s.mutex.RLock()
+	if s.timestamp.IsZero() || s.restored {
+		s.mutex.RUnlock()
+		return nil
+	}
+
+	c := checkpoint{
+		Snapshot:            s.snapshot(),
+		TimestampDifference: s.timestampDifference,
+		MeterTimestamp:      s.meterTimestamp,
+		GasFlowMeter:        s.gasFlowMeter,
+		Demand:              s.demand,
+		Cost:                s.cost.clone(),
+		Periods:             s.periods.clone(),
+	}
+
+	s.mutex.RUnlock()
+
+	if err := s.Storage.Save(checkpointName, c); err != nil {
+		return err
+	}
+
+	return s.Storage.Remove(legacyDemandName)
+}
+
+func (s *P1State) restore() error {
+	var c checkpoint
+	if err := s.Storage.Load(checkpointName, &c); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s.restoreLegacyDemand()
+		}
+
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.timestamp = c.Snapshot.Timestamp
+	s.receivedTimestamp = c.Snapshot.ReceivedTimestamp
+	s.timestampDifference = c.TimestampDifference
+	s.meterTimestamp = c.MeterTimestamp
+	s.version = c.Snapshot.Version
+	s.header = c.Snapshot.Header
+	s.equipmentIdentifier = c.Snapshot.EquipmentIdentifier
+	s.gasEquipmentIdentifier = c.Snapshot.GasEquipmentIdentifier
+	s.rawEquipmentIdentifier = c.Snapshot.RawEquipmentIdentifier
+	s.rawGasEquipmentIdentifier = c.Snapshot.RawGasEquipmentIdentifier
+	s.electricPowerDelivered = c.Snapshot.ElectricPowerDelivered
+	s.electricPowerInjected = c.Snapshot.ElectricPowerInjected
+	s.electricityTariffIndicator = c.Snapshot.ElectricityTariffIndicator
+	s.breakerState = c.Snapshot.BreakerState
+	s.breakerStateObserved = c.Snapshot.BreakerStateObserved
+	s.electricityLimiterThreshold = c.Snapshot.ElectricityLimiterThreshold
+	s.totalGasDeliveredTimestamp = c.Snapshot.TotalGasDeliveredTimestamp
+	s.totalGasDelivered = c.Snapshot.TotalGasDelivered
+	s.gasFlowMeter = c.GasFlowMeter
+	s.gasValveState = c.Snapshot.GasValveState
+	s.gasValveStateObserved = c.Snapshot.GasValveStateObserved
+	s.demand = c.Demand
+	s.cost = c.Cost
+	s.periods = c.Periods
+	s.restored = true
+
+	for k, v := range c.Snapshot.TotalElectricityDelivered {
+		s.totalElectricityDelivered[k] = v
+	}
+
+	for k, v := range c.Snapshot.TotalElectricityInjected {
+		s.totalElectricityInjected[k] = v
+	}
+
+	for k, v := range c.Snapshot.PhasePowerDelivered {
+		s.phasePowerDelivered[k] = v
+	}
+
+	for k, v := range c.Snapshot.PhasePowerInjected {
+		s.phasePowerInjected[k] = v
+	}
+
+	for k, v := range c.Snapshot.ElectricCurrent {
+		s.electricCurrent[k] = v
+	}
+
+	for k, v := range c.Snapshot.Voltage {
+		s.voltage[k] = v
+	}
+
+	for k, v := range c.Snapshot.FuseThreshold {
+		s.fuseThreshold[k] = v
+	}
+
+	s.Logger.Infoln("restored state from", s.timestamp)
+	return nil
+}
+
+// restoreLegacyDemand restores the demand peak saved before checkpoints were
+// introduced. The file is removed once the first checkpoint is saved.
+func (s *P1State) restoreLegacyDemand() error {
+	var d legacyDemand
+	if err := s.Storage.Load(legacyDemandName, &d); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.demand.PeakPower = d.Peak
+	s.demand.PeakTime = d.Timestamp
+
+	s.Logger.Infoln("restored demand peak from", legacyDemandName)
+	return nil
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestRestoreLegacyDemand(t *testing.T) {
+	st, err := NewStorage(t.TempDir(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peak := time.Date(2021, 2, 4, 16, 15, 0, 0, cet)
+	if err := st.Save(legacyDemandName, legacyDemand{Peak: 4200, Timestamp: peak}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewP1State(log.Base(), nil, st, nil)
+	if err := s.restore(); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	if p, u := s.ElectricityDemandPeak(); p != 4200 || !u.Equal(peak) {
+		t.Errorf("ElectricityDemandPeak() = %v, %v, want 4200, %v", p, u, peak)
+	}
+
+	err = s.handleTelegram(ParseTelegram(
+		"/KFM5KAIFA-METER\r\n" +
+			"0-0:1.0.0(210204163628W)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	if p, _ := s.ElectricityDemandPeak(); p != 4200 {
+		t.Errorf("ElectricityDemandPeak() = %v after a telegram, want 4200", p)
+	}
+
+	if err := s.checkpoint(); err != nil {
+		t.Fatalf("checkpoint() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(st.Path, legacyDemandName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s still exists after checkpointing", legacyDemandName)
+	}
+}
+
+func TestCheckpointOnDemandPeak(t *testing.T) {
+	st, err := NewStorage(t.TempDir(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewP1State(log.Base(), nil, st, nil)
+
+	handle := func(ts string, kwh string) {
+		err := s.handleTelegram(ParseTelegram(
+			"/KFM5KAIFA-METER\r\n" +
+				"0-0:1.0.0(" + ts + "W)\r\n" +
+				"1-0:1.8.1(" + kwh + "*kWh)\r\n",
+		))
+
+		if err != nil {
+			t.Fatalf("handleTelegram() error = %v", err)
+		}
+	}
+
+	requested := func() bool {
+		select {
+		case <-s.checkpointRequests:
+			return true
+		default:
+			return false
+		}
+	}
+
+	handle("210204155959", "000100.000")
+	handle("210204160000", "000100.000")
+	handle("210204161000", "000100.500")
+	if requested() {
+		t.Errorf("checkpoint requested before a quarter-hour was complete")
+	}
+
+	handle("210204161500", "000101.000")
+	handle("210204163000", "000102.000")
+	if !requested() {
+		t.Errorf("checkpoint not requested after the peak changed")
+	}
+}
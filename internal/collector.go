@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,13 +19,35 @@ var (
 		nil,
 	)
 
+	restoredDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "restored"),
+		"Whether the exported values were restored from storage rather than read from the smart meter.",
+		nil,
+		nil,
+	)
+
 	versionDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "version"),
-		"Version information for the P1 output.",
+		"Deprecated: use p1_meter_info. Version information for the P1 output.",
 		nil,
 		nil,
 	)
 
+	// The other series keep their equipment_id label, so that existing
+	// queries continue to work alongside joins on the info metric.
+	meterInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "meter", "info"),
+		"Identity of the smart meter and its P1 output.",
+		[]string{
+			"equipment_id",
+			"gas_equipment_id",
+			"dsmr_version",
+			"manufacturer",
+			"model",
+		},
+		nil,
+	)
+
 	electricPowerDeliveredDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "electricity", "power_delivered"),
 		"Electricity being delivered to the premises.",
@@ -55,6 +76,62 @@ var (
 		nil,
 	)
 
+	electricPowerNetDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "power_net_watts"),
+		"Electricity being delivered to the premises minus electricity being injected.",
+		[]string{"equipment_id"},
+		nil,
+	)
+
+	electricityDeliveredPeriodDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "delivered_period_watthours"),
+		"Electricity delivered to the premises in the period.",
+		[]string{"equipment_id", "period", "tariff"},
+		nil,
+	)
+
+	electricityInjectedPeriodDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "injected_period_watthours"),
+		"Electricity injected by the premises in the period.",
+		[]string{"equipment_id", "period", "tariff"},
+		nil,
+	)
+
+	totalElectricityNetDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "net_total"),
+		"Total electricity delivered to the premises minus total electricity injected, across tariffs.",
+		[]string{"equipment_id"},
+		nil,
+	)
+
+	apparentPowerDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "power_apparent_voltamperes"),
+		"Apparent power derived from the instantaneous voltage and current.",
+		[]string{"equipment_id", "phase"},
+		nil,
+	)
+
+	electricityDemandDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "demand_watts"),
+		"Average electricity delivered during the current quarter-hour.",
+		[]string{"equipment_id"},
+		nil,
+	)
+
+	electricityDemandPeakDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "demand_peak_watts"),
+		"Highest quarter-hour average of electricity delivered during the current month.",
+		[]string{"equipment_id"},
+		nil,
+	)
+
+	electricityDemandPeakTimestampDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "demand_peak_timestamp_seconds"),
+		"Start of the quarter-hour with the highest average during the current month.",
+		[]string{"equipment_id"},
+		nil,
+	)
+
 	electricCurrentDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "electricity", "current"),
 		"Instantaneous current measured by the smart meter.",
@@ -76,10 +153,17 @@ var (
 		nil,
 	)
 
+	electricityTariffActiveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "tariff_active"),
+		"Whether an electricity tariff is currently active.",
+		[]string{"equipment_id", "tariff"},
+		nil,
+	)
+
 	breakerStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "electricity", "breaker_state"),
 		"State of the smart meter's breaker.",
-		[]string{"equipment_id"},
+		[]string{"equipment_id", "state"},
 		nil,
 	)
 
@@ -97,6 +181,20 @@ var (
 		nil,
 	)
 
+	electricityCostDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "cost_total"),
+		"Total amount paid for electricity, including injection at a negative price.",
+		[]string{"equipment_id", "currency", "tariff"},
+		nil,
+	)
+
+	electricityRevenueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "electricity", "revenue_total"),
+		"Total amount received for electricity, including delivery at a negative price.",
+		[]string{"equipment_id", "currency", "tariff"},
+		nil,
+	)
+
 	totalGasDeliveredDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "gas", "delivered_total"),
 		"Total gas volume delivered to the premises.",
@@ -104,200 +202,495 @@ var (
 		nil,
 	)
 
+	gasDeliveredPeriodDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "gas", "delivered_period_cubic_meters"),
+		"Gas volume delivered to the premises in the period.",
+		[]string{"equipment_id", "period"},
+		nil,
+	)
+
+	gasCostDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "gas", "cost_total"),
+		"Total cost of the gas delivered to the premises.",
+		[]string{"equipment_id", "currency"},
+		nil,
+	)
+
+	gasFlowRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "gas", "flow_cubic_meters_per_hour"),
+		"Gas flow rate derived from the two most recent gas meter readings.",
+		[]string{"equipment_id"},
+		nil,
+	)
+
 	gasValveStateDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "gas", "valve_state"),
 		"State of the gas valve.",
-		[]string{"equipment_id"},
+		[]string{"equipment_id", "state"},
 		nil,
 	)
 )
 
 type Collector struct {
-	P1State *P1State
+	P1State     *P1State
+	TariffNames TariffNames
 }
 
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- upDesc
+	ch <- restoredDesc
 	ch <- versionDesc
+	ch <- meterInfoDesc
 	ch <- electricPowerDeliveredDesc
 	ch <- totalElectricityDeliveredDesc
 	ch <- electricPowerInjectedDesc
 	ch <- totalElectricityInjectedDesc
+	ch <- electricPowerNetDesc
+	ch <- electricityDeliveredPeriodDesc
+	ch <- electricityInjectedPeriodDesc
+	ch <- totalElectricityNetDesc
+	ch <- apparentPowerDesc
+	ch <- electricityDemandDesc
+	ch <- electricityDemandPeakDesc
+	ch <- electricityDemandPeakTimestampDesc
 	ch <- electricCurrentDesc
 	ch <- voltageDesc
 	ch <- electricityTariffIndicatorDesc
+	ch <- electricityTariffActiveDesc
 	ch <- breakerStateDesc
 	ch <- electricityLimiterThresholdDesc
 	ch <- fuseThresholdDesc
+	ch <- electricityCostDesc
+	ch <- electricityRevenueDesc
 	ch <- totalGasDeliveredDesc
+	ch <- gasDeliveredPeriodDesc
+	ch <- gasCostDesc
+	ch <- gasFlowRateDesc
 	ch <- gasValveStateDesc
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.P1State.Snapshot()
+
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
+		s.Timestamp,
 		prometheus.MustNewConstMetric(
 			upDesc,
 			prometheus.GaugeValue,
-			c.up(),
+			c.up(s),
+		),
+	)
+
+	if s.Timestamp.IsZero() {
+		return
+	}
+
+	restored := 0.0
+	if s.Restored {
+		restored = 1
+	}
+
+	ch <- prometheus.NewMetricWithTimestamp(
+		s.Timestamp,
+		prometheus.MustNewConstMetric(
+			restoredDesc,
+			prometheus.GaugeValue,
+			restored,
 		),
 	)
 
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
+		s.Timestamp,
 		prometheus.MustNewConstMetric(
 			versionDesc,
-			prometheus.CounterValue,
-			float64(c.P1State.Version()),
+			prometheus.GaugeValue,
+			float64(s.Version),
 		),
 	)
 
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
+		s.Timestamp,
+		prometheus.MustNewConstMetric(
+			meterInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			s.EquipmentIdentifier,
+			s.GasEquipmentIdentifier,
+			s.Version.String(),
+			s.Header.Manufacturer.Name,
+			s.Header.Model,
+		),
+	)
+
+	ch <- prometheus.NewMetricWithTimestamp(
+		s.Timestamp,
 		prometheus.MustNewConstMetric(
 			electricPowerDeliveredDesc,
 			prometheus.GaugeValue,
-			float64(c.P1State.ElectricPowerDelivered()),
-			c.P1State.EquipmentIndentifier(),
+			float64(s.ElectricPowerDelivered),
+			s.EquipmentIdentifier,
 		),
 	)
 
-	for k, v := range c.P1State.TotalElectricityDelivered() {
+	for k, v := range s.TotalElectricityDelivered {
 		ch <- prometheus.NewMetricWithTimestamp(
-			c.P1State.Timestamp(),
+			s.Timestamp,
 			prometheus.MustNewConstMetric(
 				totalElectricityDeliveredDesc,
 				prometheus.CounterValue,
 				float64(v),
-				c.P1State.EquipmentIndentifier(),
-				strconv.Itoa(k),
+				s.EquipmentIdentifier,
+				c.TariffNames.Name(k),
 			),
 		)
 	}
 
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
+		s.Timestamp,
 		prometheus.MustNewConstMetric(
 			electricPowerInjectedDesc,
 			prometheus.GaugeValue,
-			float64(c.P1State.ElectricPowerInjected()),
-			c.P1State.EquipmentIndentifier(),
+			float64(s.ElectricPowerInjected),
+			s.EquipmentIdentifier,
 		),
 	)
 
-	for k, v := range c.P1State.TotalElectricityInjected() {
+	for k, v := range s.TotalElectricityInjected {
 		ch <- prometheus.NewMetricWithTimestamp(
-			c.P1State.Timestamp(),
+			s.Timestamp,
 			prometheus.MustNewConstMetric(
 				totalElectricityInjectedDesc,
 				prometheus.CounterValue,
 				float64(v),
-				c.P1State.EquipmentIndentifier(),
-				strconv.Itoa(k),
+				s.EquipmentIdentifier,
+				c.TariffNames.Name(k),
 			),
 		)
 	}
 
-	for k, v := range c.P1State.ElectricCurrent() {
+	ch <- prometheus.NewMetricWithTimestamp(
+		s.Timestamp,
+		prometheus.MustNewConstMetric(
+			electricPowerNetDesc,
+			prometheus.GaugeValue,
+			float64(s.ElectricPowerNet()),
+			s.EquipmentIdentifier,
+		),
+	)
+
+	for p, t := range s.Periods {
+		for k, v := range t.Delivered {
+			ch <- prometheus.NewMetricWithTimestamp(
+				s.Timestamp,
+				prometheus.MustNewConstMetric(
+					electricityDeliveredPeriodDesc,
+					prometheus.GaugeValue,
+					float64(v),
+					s.EquipmentIdentifier,
+					p,
+					c.TariffNames.Name(k),
+				),
+			)
+		}
+
+		for k, v := range t.Injected {
+			ch <- prometheus.NewMetricWithTimestamp(
+				s.Timestamp,
+				prometheus.MustNewConstMetric(
+					electricityInjectedPeriodDesc,
+					prometheus.GaugeValue,
+					float64(v),
+					s.EquipmentIdentifier,
+					p,
+					c.TariffNames.Name(k),
+				),
+			)
+		}
+	}
+
+	ch <- prometheus.NewMetricWithTimestamp(
+		s.Timestamp,
+		prometheus.MustNewConstMetric(
+			totalElectricityNetDesc,
+			prometheus.GaugeValue,
+			float64(s.TotalElectricityNet()),
+			s.EquipmentIdentifier,
+		),
+	)
+
+	for k, v := range s.ApparentPower() {
+		ch <- prometheus.NewMetricWithTimestamp(
+			s.Timestamp,
+			prometheus.MustNewConstMetric(
+				apparentPowerDesc,
+				prometheus.GaugeValue,
+				float64(v),
+				s.EquipmentIdentifier,
+				k,
+			),
+		)
+	}
+
+	ch <- prometheus.NewMetricWithTimestamp(
+		s.Timestamp,
+		prometheus.MustNewConstMetric(
+			electricityDemandDesc,
+			prometheus.GaugeValue,
+			float64(s.ElectricityDemand),
+			s.EquipmentIdentifier,
+		),
+	)
+
+	if !s.ElectricityDemandPeakTime.IsZero() {
 		ch <- prometheus.NewMetricWithTimestamp(
-			c.P1State.Timestamp(),
+			s.Timestamp,
+			prometheus.MustNewConstMetric(
+				electricityDemandPeakDesc,
+				prometheus.GaugeValue,
+				float64(s.ElectricityDemandPeak),
+				s.EquipmentIdentifier,
+			),
+		)
+
+		ch <- prometheus.NewMetricWithTimestamp(
+			s.Timestamp,
+			prometheus.MustNewConstMetric(
+				electricityDemandPeakTimestampDesc,
+				prometheus.GaugeValue,
+				float64(s.ElectricityDemandPeakTime.Unix()),
+				s.EquipmentIdentifier,
+			),
+		)
+	}
+
+	for k, v := range s.ElectricCurrent {
+		ch <- prometheus.NewMetricWithTimestamp(
+			s.Timestamp,
 			prometheus.MustNewConstMetric(
 				electricCurrentDesc,
 				prometheus.GaugeValue,
 				float64(v),
-				c.P1State.EquipmentIndentifier(),
+				s.EquipmentIdentifier,
 				k,
 			),
 		)
 	}
 
-	for k, v := range c.P1State.Voltage() {
+	for k, v := range s.Voltage {
 		ch <- prometheus.NewMetricWithTimestamp(
-			c.P1State.Timestamp(),
+			s.Timestamp,
 			prometheus.MustNewConstMetric(
 				voltageDesc,
 				prometheus.GaugeValue,
 				float64(v),
-				c.P1State.EquipmentIndentifier(),
+				s.EquipmentIdentifier,
 				k,
 			),
 		)
 	}
 
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
+		s.Timestamp,
 		prometheus.MustNewConstMetric(
 			electricityTariffIndicatorDesc,
 			prometheus.GaugeValue,
-			float64(c.P1State.ElectricityTariffIndicator()),
-			c.P1State.EquipmentIndentifier(),
+			float64(s.ElectricityTariffIndicator),
+			s.EquipmentIdentifier,
 		),
 	)
 
-	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
-		prometheus.MustNewConstMetric(
-			breakerStateDesc,
-			prometheus.GaugeValue,
-			float64(c.P1State.BreakerState()),
-			c.P1State.EquipmentIndentifier(),
-		),
-	)
+	for _, k := range tariffs(c.TariffNames, s) {
+		v := 0.0
+		if k == s.ElectricityTariffIndicator {
+			v = 1
+		}
+
+		ch <- prometheus.NewMetricWithTimestamp(
+			s.Timestamp,
+			prometheus.MustNewConstMetric(
+				electricityTariffActiveDesc,
+				prometheus.GaugeValue,
+				v,
+				s.EquipmentIdentifier,
+				c.TariffNames.Name(k),
+			),
+		)
+	}
+
+	// Meters without a breaker don't report its state, which mustn't be
+	// mistaken for a disconnected one.
+	if s.BreakerStateObserved {
+		for _, k := range BreakerStates {
+			v := 0.0
+			if k == s.BreakerState {
+				v = 1
+			}
+
+			ch <- prometheus.NewMetricWithTimestamp(
+				s.Timestamp,
+				prometheus.MustNewConstMetric(
+					breakerStateDesc,
+					prometheus.GaugeValue,
+					v,
+					s.EquipmentIdentifier,
+					k.String(),
+				),
+			)
+		}
+	}
 
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
+		s.Timestamp,
 		prometheus.MustNewConstMetric(
 			electricityLimiterThresholdDesc,
 			prometheus.GaugeValue,
-			float64(c.P1State.ElectricityLimiterThreshold()),
-			c.P1State.EquipmentIndentifier(),
+			float64(s.ElectricityLimiterThreshold),
+			s.EquipmentIdentifier,
 		),
 	)
 
-	for k, v := range c.P1State.FuseThreshold() {
+	for k, v := range s.FuseThreshold {
 		ch <- prometheus.NewMetricWithTimestamp(
-			c.P1State.Timestamp(),
+			s.Timestamp,
 			prometheus.MustNewConstMetric(
 				fuseThresholdDesc,
 				prometheus.GaugeValue,
 				float64(v),
-				c.P1State.EquipmentIndentifier(),
+				s.EquipmentIdentifier,
 				k,
 			),
 		)
 	}
 
+	for k, v := range s.ElectricityCost {
+		ch <- prometheus.NewMetricWithTimestamp(
+			s.Timestamp,
+			prometheus.MustNewConstMetric(
+				electricityCostDesc,
+				prometheus.CounterValue,
+				v,
+				s.EquipmentIdentifier,
+				s.Currency,
+				c.TariffNames.Name(k),
+			),
+		)
+	}
+
+	for k, v := range s.ElectricityRevenue {
+		ch <- prometheus.NewMetricWithTimestamp(
+			s.Timestamp,
+			prometheus.MustNewConstMetric(
+				electricityRevenueDesc,
+				prometheus.CounterValue,
+				v,
+				s.EquipmentIdentifier,
+				s.Currency,
+				c.TariffNames.Name(k),
+			),
+		)
+	}
+
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.TotalGasDeliveredTimestamp(),
+		s.TotalGasDeliveredTimestamp,
 		prometheus.MustNewConstMetric(
 			totalGasDeliveredDesc,
 			prometheus.CounterValue,
-			float64(c.P1State.TotalGasDelivered()),
-			c.P1State.GasEquipmentIndentifier(),
+			float64(s.TotalGasDelivered),
+			s.GasEquipmentIdentifier,
 		),
 	)
 
+	if s.GasEquipmentIdentifier != "" {
+		for p, t := range s.Periods {
+			ch <- prometheus.NewMetricWithTimestamp(
+				s.TotalGasDeliveredTimestamp,
+				prometheus.MustNewConstMetric(
+					gasDeliveredPeriodDesc,
+					prometheus.GaugeValue,
+					float64(t.Gas),
+					s.GasEquipmentIdentifier,
+					p,
+				),
+			)
+		}
+	}
+
+	if s.Currency != "" {
+		ch <- prometheus.NewMetricWithTimestamp(
+			s.TotalGasDeliveredTimestamp,
+			prometheus.MustNewConstMetric(
+				gasCostDesc,
+				prometheus.CounterValue,
+				s.GasCost,
+				s.GasEquipmentIdentifier,
+				s.Currency,
+			),
+		)
+	}
+
 	ch <- prometheus.NewMetricWithTimestamp(
-		c.P1State.Timestamp(),
+		s.TotalGasDeliveredTimestamp,
 		prometheus.MustNewConstMetric(
-			gasValveStateDesc,
+			gasFlowRateDesc,
 			prometheus.GaugeValue,
-			float64(c.P1State.GasValveState()),
-			c.P1State.GasEquipmentIndentifier(),
+			float64(s.GasFlowRate),
+			s.GasEquipmentIdentifier,
 		),
 	)
+
+	if s.GasValveStateObserved {
+		for _, k := range GasValveStates {
+			v := 0.0
+			if k == s.GasValveState {
+				v = 1
+			}
+
+			ch <- prometheus.NewMetricWithTimestamp(
+				s.Timestamp,
+				prometheus.MustNewConstMetric(
+					gasValveStateDesc,
+					prometheus.GaugeValue,
+					v,
+					s.GasEquipmentIdentifier,
+					k.String(),
+				),
+			)
+		}
+	}
 }
 
-func (c *Collector) up() float64 {
-	if time.Since(c.P1State.Timestamp()) > upTimeout {
+func (c *Collector) up(s Snapshot) float64 {
+	if !s.Up() {
 		return 0
 	}
 
 	return 1
 }
 
-func NewCollector(s *P1State) *Collector {
+// tariffs returns the tariffs with counters, along with the active one.
+func tariffs(n TariffNames, s Snapshot) []int {
+	t := n.Tariffs(
+		s.TotalElectricityDelivered,
+		s.TotalElectricityInjected,
+	)
+
+	i := s.ElectricityTariffIndicator
+	if i == 0 {
+		return t
+	}
+
+	for _, k := range t {
+		if k == i {
+			return t
+		}
+	}
+
+	return append(t, i)
+}
+
+func NewCollector(s *P1State, n TariffNames) *Collector {
 	return &Collector{
-		P1State: s,
+		P1State:     s,
+		TariffNames: n,
 	}
 }
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// collect returns the metrics the collector emits for desc.
+func collect(t *testing.T, c prometheus.Collector, desc *prometheus.Desc) []*dto.Metric {
+	t.Helper()
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var ms []*dto.Metric
+	for m := range ch {
+		if m.Desc() != desc {
+			continue
+		}
+
+		var v dto.Metric
+		if err := m.Write(&v); err != nil {
+			t.Fatal(err)
+		}
+
+		ms = append(ms, &v)
+	}
+
+	return ms
+}
+
+func TestCollectorVersion(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	err := s.handleTelegram(ParseTelegram(
+		"/Ene5\\T210-D ESMR5.0\r\n" +
+			"\r\n" +
+			"0-0:96.1.4(50217)\r\n" +
+			"0-0:1.0.0(210204163628W)\r\n" +
+			"0-0:96.1.1(4B464D303031)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n" +
+			"!1234\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	c := NewCollector(s, nil)
+
+	ms := collect(t, c, versionDesc)
+	if len(ms) != 1 {
+		t.Fatalf("p1_version series = %d, want 1", len(ms))
+	}
+
+	if ms[0].Gauge == nil || ms[0].Gauge.GetValue() != 50217 {
+		t.Errorf("p1_version = %v, want gauge 50217", ms[0])
+	}
+
+	ms = collect(t, c, meterInfoDesc)
+	if len(ms) != 1 {
+		t.Fatalf("p1_meter_info series = %d, want 1", len(ms))
+	}
+
+	for _, l := range ms[0].Label {
+		if l.GetName() == "dsmr_version" && l.GetValue() != "5.0" {
+			t.Errorf("p1_meter_info dsmr_version = %q, want %q", l.GetValue(), "5.0")
+		}
+	}
+}
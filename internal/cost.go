@@ -0,0 +1,324 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+var (
+	ErrInvalidTariffPrices = errors.New("invalid tariff prices")
+	ErrInvalidPricesFile   = errors.New("invalid dynamic prices file")
+	ErrInvalidGasPrice     = errors.New("invalid gas price")
+)
+
+const dynamicPricesReloadInterval = time.Minute
+
+type Prices struct {
+	Currency          string
+	ElectricityImport map[int]float64
+	ElectricityExport map[int]float64
+	Gas               float64
+	Dynamic           *DynamicPrices
+}
+
+// ElectricityPrices returns the import and export price per kWh at the given
+// time, preferring dynamic prices over the fixed price of the tariff.
+func (p *Prices) ElectricityPrices(t time.Time, tariff int) (float64, float64) {
+	if p.Dynamic != nil {
+		if v, ok := p.Dynamic.Lookup(t); ok {
+			return v.Import, v.Export
+		}
+	}
+
+	return p.ElectricityImport[tariff], p.ElectricityExport[tariff]
+}
+
+type DynamicPrice struct {
+	Start  time.Time `json:"start"`
+	Import float64   `json:"import"`
+	Export float64   `json:"export"`
+}
+
+// DynamicPrices holds the prices read from a CSV or JSON file, which is
+// reloaded when it changes so that it can be updated by an external job.
+type DynamicPrices struct {
+	Logger log.Logger
+	Path   string
+
+	mutex    sync.RWMutex
+	modified time.Time
+	prices   []DynamicPrice
+	missed   time.Time
+}
+
+// Start reloads the file periodically. The last prices which were read
+// successfully remain in use until the file can be read again.
+func (p *DynamicPrices) Start() {
+	t := time.NewTicker(dynamicPricesReloadInterval)
+	defer t.Stop()
+
+	for range t.C {
+		if err := p.reload(); err != nil {
+			p.Logger.Errorln("failed to reload dynamic prices:", err)
+		}
+	}
+}
+
+// Lookup returns the price in effect at the given time. Each price applies
+// until the start of the next one, but for at most one hour, so that a gap
+// in the file falls back to the tariff price.
+func (p *DynamicPrices) Lookup(t time.Time) (DynamicPrice, bool) {
+	p.mutex.RLock()
+	v, ok := p.lookup(t)
+	p.mutex.RUnlock()
+
+	if !ok {
+		p.warnMissing(t)
+	}
+
+	return v, ok
+}
+
+func (p *DynamicPrices) lookup(t time.Time) (DynamicPrice, bool) {
+	i := sort.Search(len(p.prices), func(i int) bool {
+		return p.prices[i].Start.After(t)
+	})
+
+	if i == 0 {
+		return DynamicPrice{}, false
+	}
+
+	v := p.prices[i-1]
+	if t.Sub(v.Start) >= time.Hour {
+		return DynamicPrice{}, false
+	}
+
+	return v, true
+}
+
+// warnMissing logs once per hour without a dynamic price, for which the
+// fixed price of the tariff is used instead.
+func (p *DynamicPrices) warnMissing(t time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	h := t.Truncate(time.Hour)
+	if h.Equal(p.missed) {
+		return
+	}
+
+	p.missed = h
+	p.Logger.Warnf("no dynamic price at %v, using the tariff price", t)
+}
+
+func (p *DynamicPrices) reload() error {
+	fi, err := os.Stat(p.Path)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.RLock()
+	modified := p.modified
+	p.mutex.RUnlock()
+
+	if fi.ModTime().Equal(modified) {
+		return nil
+	}
+
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var v []DynamicPrice
+	if strings.EqualFold(filepath.Ext(p.Path), ".json") {
+		err = json.NewDecoder(f).Decode(&v)
+	} else {
+		v, err = readDynamicPricesCSV(f)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(v, func(i, j int) bool {
+		return v[i].Start.Before(v[j].Start)
+	})
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.modified = fi.ModTime()
+	p.prices = v
+
+	return nil
+}
+
+func readDynamicPricesCSV(r io.Reader) ([]DynamicPrice, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = 3
+	c.TrimLeadingSpace = true
+
+	rs, err := c.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	v := make([]DynamicPrice, 0, len(rs))
+	for i, r := range rs {
+		t, err := time.Parse(time.RFC3339, r[0])
+		if err != nil {
+			// The first line may be a header.
+			if i == 0 {
+				continue
+			}
+
+			return nil, err
+		}
+
+		im, err := strconv.ParseFloat(r[1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		ex, err := strconv.ParseFloat(r[2], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		v = append(v, DynamicPrice{Start: t, Import: im, Export: ex})
+	}
+
+	return v, nil
+}
+
+func LoadDynamicPrices(l log.Logger, path string) (*DynamicPrices, error) {
+	p := &DynamicPrices{
+		Logger: l,
+		Path:   path,
+	}
+
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+
+	if len(p.prices) == 0 {
+		return nil, ErrInvalidPricesFile
+	}
+
+	return p, nil
+}
+
+func ParseTariffPrices(s string) (map[int]float64, error) {
+	p := make(map[int]float64)
+	if s == "" {
+		return p, nil
+	}
+
+	for _, v := range strings.Split(s, ",") {
+		k, price, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, ErrInvalidTariffPrices
+		}
+
+		t, err := strconv.Atoi(strings.TrimSpace(k))
+		if err != nil {
+			return nil, err
+		}
+
+		u, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		p[t] = u
+	}
+
+	return p, nil
+}
+
+// costTracker accumulates cost from increases of the energy and volume
+// counters, so that prices apply to the period in which energy was used.
+// Dynamic prices can be negative, so the amount paid and the amount received
+// are kept apart to keep both counters monotonic.
+type costTracker struct {
+	Delivered          map[int]Energy  `json:"delivered"`
+	Injected           map[int]Energy  `json:"injected"`
+	Gas                Volume          `json:"gas"`
+	ElectricityCost    map[int]float64 `json:"electricity_cost"`
+	ElectricityRevenue map[int]float64 `json:"electricity_revenue"`
+	GasCost            float64         `json:"gas_cost"`
+}
+
+func (c *costTracker) Update(
+	p *Prices,
+	t time.Time,
+	delivered map[int]Energy,
+	injected map[int]Energy,
+	gas Volume,
+) {
+	if c.Delivered == nil {
+		c.Delivered = make(map[int]Energy)
+		c.Injected = make(map[int]Energy)
+		c.ElectricityCost = make(map[int]float64)
+		c.ElectricityRevenue = make(map[int]float64)
+	}
+
+	for k, v := range delivered {
+		var d float64
+		if u, ok := c.Delivered[k]; ok && v > u {
+			i, _ := p.ElectricityPrices(t, k)
+			d = float64(v-u) / 1000 * i
+		}
+
+		c.add(k, d)
+
+		c.Delivered[k] = v
+	}
+
+	for k, v := range injected {
+		var d float64
+		if u, ok := c.Injected[k]; ok && v > u {
+			_, e := p.ElectricityPrices(t, k)
+			d = float64(v-u) / 1000 * e
+		}
+
+		c.add(k, -d)
+
+		c.Injected[k] = v
+	}
+
+	if c.Gas > 0 && gas > c.Gas {
+		c.GasCost += float64(gas-c.Gas) * p.Gas
+	}
+
+	c.Gas = gas
+}
+
+// add books an amount as cost when positive and as revenue when negative.
+func (c *costTracker) add(tariff int, v float64) {
+	c.ElectricityCost[tariff] += max(v, 0)
+	c.ElectricityRevenue[tariff] += max(-v, 0)
+}
+
+func (c costTracker) clone() costTracker {
+	c.Delivered = copyMap(c.Delivered)
+	c.Injected = copyMap(c.Injected)
+	c.ElectricityCost = copyMap(c.ElectricityCost)
+	c.ElectricityRevenue = copyMap(c.ElectricityRevenue)
+
+	return c
+}
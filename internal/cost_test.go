@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestDynamicPricesLookup(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "prices.csv")
+	err := os.WriteFile(
+		p,
+		[]byte(
+			"start,import,export\n"+
+				"2021-02-04T16:00:00+01:00,0.30,0.05\n"+
+				"2021-02-04T17:00:00+01:00,0.40,0.06\n"+
+				"2021-02-04T19:00:00+01:00,-0.02,-0.05\n",
+		),
+		0o600,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := LoadDynamicPrices(log.Base(), p)
+	if err != nil {
+		t.Fatalf("LoadDynamicPrices() error = %v", err)
+	}
+
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	tests := []struct {
+		time   time.Time
+		price  float64
+		exists bool
+	}{
+		{at("2021-02-04T15:59:59+01:00"), 0, false},
+		{at("2021-02-04T16:00:00+01:00"), 0.30, true},
+		{at("2021-02-04T16:59:59+01:00"), 0.30, true},
+		{at("2021-02-04T17:30:00+01:00"), 0.40, true},
+		{at("2021-02-04T18:00:00+01:00"), 0, false},
+		{at("2021-02-04T19:00:00+01:00"), -0.02, true},
+		{at("2021-02-04T20:00:00+01:00"), 0, false},
+	}
+
+	for _, tt := range tests {
+		v, ok := d.Lookup(tt.time)
+		if ok != tt.exists || v.Import != tt.price {
+			t.Errorf("Lookup(%v) = %v, %v, want %v, %v", tt.time, v.Import, ok, tt.price, tt.exists)
+		}
+	}
+
+	// A file which can't be read mustn't discard the prices read before.
+	if err := os.WriteFile(p, []byte("invalid,file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(p, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.reload(); err == nil {
+		t.Errorf("reload() of an invalid file succeeded")
+	}
+
+	if v, ok := d.Lookup(at("2021-02-04T16:30:00+01:00")); !ok || v.Import != 0.30 {
+		t.Errorf("Lookup() after a failed reload = %v, %v, want 0.30, true", v.Import, ok)
+	}
+}
+
+func TestCostTrackerUpdate(t *testing.T) {
+	p := &Prices{
+		ElectricityImport: map[int]float64{1: 0.30, 2: -0.10},
+		ElectricityExport: map[int]float64{1: 0.05, 2: -0.02},
+		Gas:               1.2,
+	}
+
+	type reading struct {
+		delivered Energy
+		injected  Energy
+		gas       Volume
+	}
+
+	tests := []struct {
+		name     string
+		tariff   int
+		readings []reading
+		cost     float64
+		revenue  float64
+		gasCost  float64
+	}{
+		{
+			name:     "first reading",
+			tariff:   1,
+			readings: []reading{{1000, 1000, 10}},
+		},
+		{
+			name:     "accumulation",
+			tariff:   1,
+			readings: []reading{{1000, 1000, 10}, {2000, 1000, 10.5}, {4000, 3000, 11}},
+			cost:     0.90,
+			revenue:  0.10,
+			gasCost:  1.2,
+		},
+		{
+			name:     "negative prices",
+			tariff:   2,
+			readings: []reading{{1000, 1000, 10}, {3000, 2000, 10}},
+			cost:     0.02,
+			revenue:  0.20,
+		},
+		{
+			name:     "counter decrease",
+			tariff:   1,
+			readings: []reading{{4000, 4000, 20}, {1000, 1000, 10}, {2000, 2000, 11}},
+			cost:     0.30,
+			revenue:  0.05,
+			gasCost:  1.2,
+		},
+	}
+
+	for _, tt := range tests {
+		var c costTracker
+		for _, r := range tt.readings {
+			c.Update(
+				p,
+				time.Time{},
+				map[int]Energy{tt.tariff: r.delivered},
+				map[int]Energy{tt.tariff: r.injected},
+				r.gas,
+			)
+		}
+
+		if v := c.ElectricityCost[tt.tariff]; math.Abs(v-tt.cost) > 1e-9 {
+			t.Errorf("%s: ElectricityCost = %v, want %v", tt.name, v, tt.cost)
+		}
+
+		if v := c.ElectricityRevenue[tt.tariff]; math.Abs(v-tt.revenue) > 1e-9 {
+			t.Errorf("%s: ElectricityRevenue = %v, want %v", tt.name, v, tt.revenue)
+		}
+
+		if math.Abs(c.GasCost-tt.gasCost) > 1e-9 {
+			t.Errorf("%s: GasCost = %v, want %v", tt.name, c.GasCost, tt.gasCost)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// csvTimeLayout includes the UTC offset, so that the hour which repeats when
+// daylight saving time ends remains unambiguous.
+const csvTimeLayout = "2006-01-02 15:04:05-07:00"
+
+var csvTimestampColumns = []string{"meter_timestamp", "host_timestamp"}
+
+type CSVConfig struct {
+	Path     string
+	Interval time.Duration
+}
+
+// CSVWriter appends snapshots to a CSV file per day. Columns are never
+// reordered: fields which weren't written before are added as new columns at
+// the end, rewriting the current file's header.
+type CSVWriter struct {
+	Logger      log.Logger
+	P1State     *P1State
+	TariffNames TariffNames
+	Config      CSVConfig
+
+	columns []string
+	date    string
+	file    *os.File
+	writer  *csv.Writer
+	last    time.Time
+}
+
+func (w *CSVWriter) Start() {
+	c := w.P1State.Subscribe()
+	for s := range c {
+		if err := w.write(s); err != nil {
+			w.Logger.Errorln("unable to write CSV:", err)
+		}
+	}
+}
+
+func (w *CSVWriter) write(s Snapshot) error {
+	if s.MeterTimestamp.IsZero() || s.ReceivedTimestamp.Sub(w.last) < w.Config.Interval {
+		return nil
+	}
+
+	if d := s.MeterTimestamp.Format(time.DateOnly); d != w.date {
+		if err := w.open(d); err != nil {
+			return err
+		}
+	}
+
+	v := map[string]string{
+		"meter_timestamp": s.MeterTimestamp.Format(csvTimeLayout),
+		"host_timestamp":  s.ReceivedTimestamp.Local().Format(csvTimeLayout),
+	}
+
+	cs := slices.Clone(w.columns)
+	for _, f := range s.Fields(w.TariffNames) {
+		k := csvColumn(f)
+		if !slices.Contains(cs, k) {
+			cs = append(cs, k)
+		}
+
+		v[k] = f.String()
+	}
+
+	if len(cs) != len(w.columns) {
+		if err := w.rewrite(w.date, cs); err != nil {
+			return err
+		}
+	}
+
+	r := make([]string, len(w.columns))
+	for i, k := range w.columns {
+		r[i] = v[k]
+	}
+
+	if err := w.writer.Write(r); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+	w.last = s.ReceivedTimestamp
+
+	return w.writer.Error()
+}
+
+// open switches to the file of the given date. The date is only set once the
+// file has been opened, so the next write tries again when this fails.
+func (w *CSVWriter) open(date string) error {
+	w.close()
+
+	p := w.path(date)
+
+	// Continue an existing file with its own columns, appending the ones it
+	// doesn't have yet.
+	h, _, err := readCSV(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	cs := slices.Clone(h)
+	if len(cs) == 0 {
+		cs = slices.Clone(csvTimestampColumns)
+	}
+
+	for _, k := range w.columns {
+		if !slices.Contains(cs, k) {
+			cs = append(cs, k)
+		}
+	}
+
+	if len(h) > 0 && len(cs) == len(h) {
+		return w.append(date, cs)
+	}
+
+	return w.rewrite(date, cs)
+}
+
+func (w *CSVWriter) append(date string, cs []string) error {
+	f, err := os.OpenFile(w.path(date), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+
+	w.columns = cs
+	w.date = date
+	w.file = f
+	w.writer = csv.NewWriter(f)
+
+	return nil
+}
+
+func (w *CSVWriter) close() {
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	w.date = ""
+	w.file = nil
+	w.writer = nil
+}
+
+func (w *CSVWriter) path(date string) string {
+	return filepath.Join(w.Config.Path, "p1-"+date+".csv")
+}
+
+// rewrite writes the current file again with the given columns, existing
+// rows are padded.
+func (w *CSVWriter) rewrite(date string, cs []string) error {
+	w.close()
+
+	p := w.path(date)
+
+	_, rs, err := readCSV(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.CreateTemp(w.Config.Path, filepath.Base(p))
+	if err != nil {
+		return err
+	}
+
+	// Temporary files are only readable by their owner, unlike the files
+	// which are appended to.
+	if err := f.Chmod(0o640); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	c := csv.NewWriter(f)
+	c.Write(cs)
+
+	for _, r := range rs {
+		c.Write(append(r, make([]string, max(len(cs)-len(r), 0))...))
+	}
+
+	c.Flush()
+	if err := c.Error(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), p); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return w.append(date, cs)
+}
+
+func readCSV(p string) ([]string, [][]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+
+	h, err := r.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rs, err := r.ReadAll()
+	return h, rs, err
+}
+
+func csvColumn(f Field) string {
+	k := f.Subsystem + "_" + f.Key()
+	if f.Unit != "" {
+		k += " (" + f.Unit + ")"
+	}
+
+	return k
+}
+
+func NewCSVWriter(
+	l log.Logger,
+	s *P1State,
+	n TariffNames,
+	c CSVConfig,
+) (*CSVWriter, error) {
+	if err := os.MkdirAll(c.Path, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &CSVWriter{
+		Logger:      l,
+		P1State:     s,
+		TariffNames: n,
+		Config:      c,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestCSVWriterRetriesOpen(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "csv")
+
+	w, err := NewCSVWriter(log.Base(), nil, nil, CSVConfig{Path: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, cet)
+	s := Snapshot{
+		MeterTimestamp:    ts,
+		ReceivedTimestamp: ts,
+	}
+
+	// The directory is gone, e.g. because a USB stick isn't mounted.
+	if err := os.RemoveAll(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.write(s); err == nil {
+		t.Fatal("write() succeeded without a directory")
+	}
+
+	if err := os.MkdirAll(d, 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	s.ReceivedTimestamp = ts.Add(10 * time.Second)
+	if err := w.write(s); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(d, "p1-2024-03-01.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(string(b), "\n"); n != 2 {
+		t.Errorf("file has %d lines, want a header and a row", n)
+	}
+}
+
+func TestCSVWriterRewrite(t *testing.T) {
+	d := t.TempDir()
+
+	w, err := NewCSVWriter(log.Base(), nil, nil, CSVConfig{Path: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hour which repeats when daylight saving time ends.
+	ts := time.Date(2024, 10, 27, 2, 30, 0, 0, cest)
+	s := Snapshot{
+		MeterTimestamp:    ts,
+		ReceivedTimestamp: ts,
+	}
+
+	if err := w.write(s); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	if err := w.rewrite(w.date, append(w.columns, "extra")); err != nil {
+		t.Fatalf("rewrite() error = %v", err)
+	}
+
+	w.close()
+
+	p := filepath.Join(d, "p1-2024-10-27.csv")
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := fi.Mode().Perm(); m != 0o640 {
+		t.Errorf("mode = %v, want %v", m, os.FileMode(0o640))
+	}
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), "2024-10-27 02:30:00+02:00") {
+		t.Errorf("file = %q, want the meter timestamp with its offset", b)
+	}
+
+	if !strings.HasSuffix(strings.SplitN(string(b), "\n", 2)[0], ",extra") {
+		t.Errorf("header = %q, want the extra column", strings.SplitN(string(b), "\n", 2)[0])
+	}
+}
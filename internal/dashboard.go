@@ -0,0 +1,35 @@
+package internal
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(
+	template.New("dashboard").Parse(dashboardHTML),
+)
+
+// Dashboard renders a page showing the meter's live readings, which are
+// fetched from the snapshot and stream APIs.
+type Dashboard struct {
+	P1State     *P1State
+	MetricsPath string
+}
+
+func (d *Dashboard) ServeDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, d); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func NewDashboard(s *P1State, metricsPath string) *Dashboard {
+	return &Dashboard{
+		P1State:     s,
+		MetricsPath: metricsPath,
+	}
+}
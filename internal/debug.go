@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/skoef/gop1"
+)
+
+var debugTelegramTemplate = template.Must(
+	template.New("telegram").Parse(
+		`<!DOCTYPE html>
+		<html>
+		<head>
+		<meta charset="utf-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+		<title>P1 Exporter - Telegram</title>
+		<style>
+		body { font: 14px/1.4 system-ui, sans-serif; margin: 1rem; }
+		pre, code { font: 13px/1.4 ui-monospace, monospace; }
+		pre { background: #f3f4f5; padding: .75rem; overflow-x: auto; }
+		table { border-collapse: collapse; }
+		th, td { text-align: left; vertical-align: top; padding: .2rem .75rem .2rem 0; }
+		.error { color: #d9534f; }
+		.muted { color: #6b7378; }
+		</style>
+		</head>
+		<body>
+		<h1>Telegram</h1>
+		{{ if .Telegram }}
+		{{ with .Error }}
+		<p class="error">Rejected: {{ . }}</p>
+		{{ else }}
+		<p>Received {{ .Received.Format "2006-01-02 15:04:05 MST" }}.</p>
+		{{ end }}
+		<h2>Raw</h2>
+		<pre>{{ .Telegram.Raw }}</pre>
+		<h2>Lines</h2>
+		<table>
+		<tr><th>Line</th><th>Type</th><th>Interpretation</th></tr>
+		{{ range .Lines }}
+		<tr>
+		<td><code>{{ .Text }}</code></td>
+		<td>{{ .Type }}</td>
+		{{ if .Error }}
+		<td class="error">{{ .Error }}</td>
+		{{ else if .Interpretation }}
+		<td>{{ .Interpretation }}</td>
+		{{ else if .Skipped }}
+		<td class="muted">skipped</td>
+		{{ else if .Code }}
+		<td class="muted">not handled</td>
+		{{ else }}
+		<td></td>
+		{{ end }}
+		</tr>
+		{{ end }}
+		</table>
+		<h2>Unhandled OBIS codes</h2>
+		{{ if .Unhandled }}
+		<ul>{{ range .Unhandled }}<li><code>{{ . }}</code></li>{{ end }}</ul>
+		{{ else }}
+		<p class="muted">None.</p>
+		{{ end }}
+		{{ else }}
+		<p>No telegram has been received yet.</p>
+		{{ end }}
+		</body>
+		</html>`,
+	),
+)
+
+type telegramLineResponse struct {
+	Text           string
+	Code           string
+	Type           gop1.OBISType
+	Interpretation string
+	Error          error
+	Skipped        bool
+}
+
+// ServeTelegram renders the most recent telegram along with how each of its
+// lines was interpreted, to find out what the meter actually sent.
+func (d *Dashboard) ServeTelegram(w http.ResponseWriter, r *http.Request) {
+	t := d.P1State.Telegram()
+
+	v := struct {
+		Telegram  *Telegram
+		Received  time.Time
+		Error     error
+		Lines     []telegramLineResponse
+		Unhandled []string
+	}{
+		Telegram: t,
+		Received: d.P1State.Snapshot().ReceivedTimestamp,
+		Error:    d.P1State.TelegramError(),
+	}
+
+	if t != nil {
+		v.Lines, v.Unhandled = interpretTelegram(t)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := debugTelegramTemplate.Execute(w, v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func interpretTelegram(t *Telegram) ([]telegramLineResponse, []string) {
+	var (
+		ls       []telegramLineResponse
+		us       = make(map[string]struct{})
+		rejected bool
+	)
+
+	// Objects following one which couldn't be handled were never reached.
+	for _, l := range t.Lines {
+		v := telegramLineResponse{
+			Text:           l.Text,
+			Code:           l.Code,
+			Interpretation: l.Interpretation,
+			Error:          l.Error,
+		}
+
+		if l.Object != nil {
+			v.Type = l.Object.Type
+			v.Skipped = rejected
+			rejected = rejected || l.Error != nil
+		}
+
+		if l.Code != "" && l.Interpretation == "" && l.Error == nil && !v.Skipped {
+			us[l.Code] = struct{}{}
+		}
+
+		ls = append(ls, v)
+	}
+
+	u := make([]string, 0, len(us))
+	for k := range us {
+		u = append(u, k)
+	}
+
+	sort.Strings(u)
+	return ls, u
+}
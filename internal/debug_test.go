@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestInterpretTelegram(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+	v := ParseTelegram(
+		"/ISk5\\2MT382-1000\r\n" +
+			"\r\n" +
+			"0-0:96.1.4(50217)\r\n" +
+			"1-0:1.4.0(00.123*kW)\r\n" +
+			"1-0:1.8.1()\r\n" +
+			"1-0:1.8.2(000456.789*kWh)\r\n" +
+			"0-0:96.3.10(7)\r\n" +
+			"1-0:1.7.0(00.500*kW)\r\n" +
+			"!1234\r\n",
+	)
+
+	if err := s.handleTelegram(v); !errors.Is(err, ErrUnknownBreakerState) {
+		t.Fatalf("handleTelegram() error = %v, want %v", err, ErrUnknownBreakerState)
+	}
+
+	ls, us := interpretTelegram(v)
+
+	want := []struct {
+		interpretation string
+		err            error
+		skipped        bool
+	}{
+		{},
+		{interpretation: "DSMR version: 5.0"},
+		{},
+		{err: ErrInvalidTelegramValue},
+		{interpretation: "delivered, tariff 2: 456789 Wh"},
+		{err: ErrUnknownBreakerState},
+		{skipped: true},
+		{},
+	}
+
+	if len(ls) != len(want) {
+		t.Fatalf("interpretTelegram() = %d lines, want %d", len(ls), len(want))
+	}
+
+	for i, w := range want {
+		l := ls[i]
+		if l.Interpretation != w.interpretation || !errors.Is(l.Error, w.err) || l.Skipped != w.skipped {
+			t.Errorf(
+				"line %q = %q, %v, %v, want %q, %v, %v",
+				l.Text, l.Interpretation, l.Error, l.Skipped, w.interpretation, w.err, w.skipped,
+			)
+		}
+	}
+
+	if !reflect.DeepEqual(us, []string{"1-0:1.4.0"}) {
+		t.Errorf("unhandled = %v, want [1-0:1.4.0]", us)
+	}
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"time"
+)
+
+const demandPeriod = 15 * time.Minute
+
+// demandTracker integrates the delivered energy into aligned quarter-hour
+// windows, mimicking the demand register of meters that don't report it.
+type demandTracker struct {
+	Start       time.Time `json:"start"`
+	StartEnergy Energy    `json:"start_energy"`
+	Complete    bool      `json:"complete"`
+	Timestamp   time.Time `json:"timestamp"`
+	Energy      Energy    `json:"energy"`
+	PeakPower   Power     `json:"peak"`
+	PeakTime    time.Time `json:"peak_time"`
+}
+
+func (d *demandTracker) Update(t time.Time, e Energy) {
+	if !t.After(d.Timestamp) {
+		return
+	}
+
+	w := t.Truncate(demandPeriod)
+	if w.After(d.Start) {
+		// Only windows that were observed from start to end are complete.
+		contiguous := !d.Start.IsZero() && w.Equal(d.Start.Add(demandPeriod))
+		if d.Complete && contiguous {
+			d.record(d.Start, average(e-d.StartEnergy, demandPeriod))
+		}
+
+		d.Start = w
+		d.StartEnergy = e
+		d.Complete = contiguous
+	}
+
+	d.Timestamp = t
+	d.Energy = e
+
+	if !sameMonth(d.PeakTime, t) {
+		d.PeakPower = 0
+		d.PeakTime = time.Time{}
+	}
+}
+
+func (d *demandTracker) Average() Power {
+	return average(d.Energy-d.StartEnergy, d.Timestamp.Sub(d.Start))
+}
+
+func (d *demandTracker) Peak() (Power, time.Time) {
+	return d.PeakPower, d.PeakTime
+}
+
+func (d *demandTracker) record(t time.Time, p Power) {
+	if sameMonth(d.PeakTime, t) && p <= d.PeakPower {
+		return
+	}
+
+	d.PeakPower = p
+	d.PeakTime = t
+}
+
+func average(e Energy, d time.Duration) Power {
+	if d <= 0 {
+		return 0
+	}
+
+	return Power(float64(e) / d.Hours())
+}
+
+func sameMonth(a, b time.Time) bool {
+	if a.IsZero() || b.IsZero() {
+		return false
+	}
+
+	a = a.In(b.Location())
+	return a.Year() == b.Year() && a.Month() == b.Month()
+}
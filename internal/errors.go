@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+const errorLogSize = 20
+
+type ErrorRecord struct {
+	Timestamp time.Time
+	Message   string
+}
+
+// errorLog keeps the most recent errors, so they can be shown without access
+// to the exporter's logs.
+type errorLog struct {
+	mutex   sync.Mutex
+	records []ErrorRecord
+}
+
+func (l *errorLog) Record(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.records) == errorLogSize {
+		l.records = l.records[1:]
+	}
+
+	l.records = append(l.records, ErrorRecord{
+		Timestamp: time.Now(),
+		Message:   err.Error(),
+	})
+}
+
+func (l *errorLog) Records() []ErrorRecord {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]ErrorRecord(nil), l.records...)
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Field is a single value of a snapshot, used by sinks which publish values
+// individually rather than as a whole.
+type Field struct {
+	Subsystem string
+	Name      string
+	Tariff    string
+	Phase     string
+	Unit      string
+	Value     float64
+	State     string
+}
+
+// Key identifies the field within its subsystem, e.g. delivered_peak or
+// voltage_l1.
+func (f Field) Key() string {
+	k := f.Name
+	if f.Tariff != "" {
+		k += "_" + f.Tariff
+	}
+
+	if f.Phase != "" {
+		k += "_" + f.Phase
+	}
+
+	return k
+}
+
+func (f Field) String() string {
+	if f.State != "" {
+		return f.State
+	}
+
+	return strconv.FormatFloat(f.Value, 'f', -1, 64)
+}
+
+func (s Snapshot) Fields(n TariffNames) []Field {
+	var fs []Field
+
+	electricity := func(name, unit string, v float64) {
+		fs = append(fs, Field{Subsystem: "electricity", Name: name, Unit: unit, Value: v})
+	}
+
+	tariffs := func(name, unit string, m map[int]float64) {
+		for _, k := range sortedKeys(m) {
+			fs = append(fs, Field{
+				Subsystem: "electricity",
+				Name:      name,
+				Tariff:    n.Name(k),
+				Unit:      unit,
+				Value:     m[k],
+			})
+		}
+	}
+
+	phases := func(name, unit string, m map[string]float64) {
+		for _, k := range sortedKeys(m) {
+			fs = append(fs, Field{
+				Subsystem: "electricity",
+				Name:      name,
+				Phase:     k,
+				Unit:      unit,
+				Value:     m[k],
+			})
+		}
+	}
+
+	electricity("power_delivered", "W", float64(s.ElectricPowerDelivered))
+	electricity("power_injected", "W", float64(s.ElectricPowerInjected))
+	electricity("power_net", "W", float64(s.ElectricPowerNet()))
+	tariffs("delivered", "Wh", floats(s.TotalElectricityDelivered))
+	tariffs("injected", "Wh", floats(s.TotalElectricityInjected))
+	electricity("net", "Wh", float64(s.TotalElectricityNet()))
+	phases("current", "A", floats(s.ElectricCurrent))
+	phases("voltage", "V", floats(s.Voltage))
+	phases("apparent_power", "VA", floats(s.ApparentPower()))
+
+	fs = append(fs, Field{
+		Subsystem: "electricity",
+		Name:      "tariff",
+		State:     n.Name(s.ElectricityTariffIndicator),
+	})
+
+	if s.BreakerStateObserved {
+		fs = append(fs, Field{
+			Subsystem: "electricity",
+			Name:      "breaker_state",
+			State:     s.BreakerState.String(),
+		})
+	}
+
+	electricity("limiter_threshold", "W", float64(s.ElectricityLimiterThreshold))
+	phases("fuse_threshold", "A", floats(s.FuseThreshold))
+	electricity("demand", "W", float64(s.ElectricityDemand))
+	electricity("demand_peak", "W", float64(s.ElectricityDemandPeak))
+
+	if s.Currency != "" {
+		tariffs("cost", s.Currency, s.ElectricityCost)
+		tariffs("revenue", s.Currency, s.ElectricityRevenue)
+	}
+
+	if s.GasEquipmentIdentifier != "" {
+		fs = append(
+			fs,
+			Field{
+				Subsystem: "gas",
+				Name:      "delivered",
+				Unit:      "m3",
+				Value:     float64(s.TotalGasDelivered),
+			},
+			Field{
+				Subsystem: "gas",
+				Name:      "flow_rate",
+				Unit:      "m3/h",
+				Value:     float64(s.GasFlowRate),
+			},
+		)
+
+		if s.GasValveStateObserved {
+			fs = append(fs, Field{
+				Subsystem: "gas",
+				Name:      "valve_state",
+				State:     s.GasValveState.String(),
+			})
+		}
+
+		if s.Currency != "" {
+			fs = append(fs, Field{
+				Subsystem: "gas",
+				Name:      "cost",
+				Unit:      s.Currency,
+				Value:     s.GasCost,
+			})
+		}
+	}
+
+	return fs
+}
+
+func floats[K comparable, V ~float64](m map[K]V) map[K]float64 {
+	r := make(map[K]float64, len(m))
+	for k, v := range m {
+		r[k] = float64(v)
+	}
+
+	return r
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	r := make([]K, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i] < r[j]
+	})
+
+	return r
+}
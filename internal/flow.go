@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"time"
+)
+
+// flowMeter derives a flow rate from the periodic readings of an M-Bus meter,
+// which are only updated every five minutes for DSMR 5 and hourly for DSMR 4.
+type flowMeter struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Volume    Volume         `json:"volume"`
+	FlowRate  VolumeFlowRate `json:"rate"`
+}
+
+func (m *flowMeter) Update(t time.Time, v Volume) {
+	if !t.After(m.Timestamp) {
+		return
+	}
+
+	switch {
+	case m.Timestamp.IsZero():
+		m.FlowRate = 0
+	case v < m.Volume:
+		m.FlowRate = 0
+	default:
+		m.FlowRate = VolumeFlowRate(
+			float64(v-m.Volume) / t.Sub(m.Timestamp).Hours(),
+		)
+	}
+
+	m.Timestamp = t
+	m.Volume = v
+}
+
+func (m *flowMeter) Rate() VolumeFlowRate {
+	return m.FlowRate
+}
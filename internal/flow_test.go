@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlowMeterUpdate(t *testing.T) {
+	t0 := time.Date(2021, 2, 4, 16, 0, 0, 0, time.UTC)
+
+	type reading struct {
+		time   time.Time
+		volume Volume
+	}
+
+	tests := []struct {
+		name     string
+		readings []reading
+		rate     VolumeFlowRate
+	}{
+		{
+			name:     "first reading",
+			readings: []reading{{t0, 100}},
+			rate:     0,
+		},
+		{
+			name:     "consecutive readings",
+			readings: []reading{{t0, 100}, {t0.Add(5 * time.Minute), 100.5}},
+			rate:     6,
+		},
+		{
+			name:     "hourly readings",
+			readings: []reading{{t0, 100}, {t0.Add(time.Hour), 101.5}},
+			rate:     1.5,
+		},
+		{
+			name:     "no flow",
+			readings: []reading{{t0, 100}, {t0.Add(5 * time.Minute), 100.5}, {t0.Add(10 * time.Minute), 100.5}},
+			rate:     0,
+		},
+		{
+			name:     "equal timestamp",
+			readings: []reading{{t0, 100}, {t0.Add(5 * time.Minute), 100.5}, {t0.Add(5 * time.Minute), 101}},
+			rate:     6,
+		},
+		{
+			name:     "earlier timestamp",
+			readings: []reading{{t0, 100}, {t0.Add(5 * time.Minute), 100.5}, {t0, 101}},
+			rate:     6,
+		},
+		{
+			name:     "counter reset",
+			readings: []reading{{t0, 100}, {t0.Add(5 * time.Minute), 100.5}, {t0.Add(10 * time.Minute), 0.5}},
+			rate:     0,
+		},
+		{
+			name:     "after counter reset",
+			readings: []reading{{t0, 100}, {t0.Add(5 * time.Minute), 0.5}, {t0.Add(10 * time.Minute), 1}},
+			rate:     6,
+		},
+	}
+
+	for _, tt := range tests {
+		var m flowMeter
+		for _, r := range tt.readings {
+			m.Update(r.time, r.volume)
+		}
+
+		if v := m.Rate(); v != tt.rate {
+			t.Errorf("%s: Rate() = %v, want %v", tt.name, v, tt.rate)
+		}
+	}
+}
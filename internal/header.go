@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"strings"
+)
+
+type Manufacturer struct {
+	Code string
+	Name string
+}
+
+var manufacturers = map[string]Manufacturer{
+	"ELS": {Name: "Elster"},
+	"ENE": {Name: "Sagemcom"},
+	"FLU": {Name: "Fluvius"},
+	"ISK": {Name: "Iskraemeco"},
+	"KFM": {Name: "Kaifa"},
+	"KMP": {Name: "Kamstrup"},
+	"LGF": {Name: "Landis+Gyr"},
+	"SAG": {Name: "Sagemcom"},
+	"XMX": {Name: "Landis+Gyr"},
+	"ZCF": {Name: "Landis+Gyr"},
+}
+
+func LookupManufacturer(code string) Manufacturer {
+	code = strings.ToUpper(code)
+
+	m, ok := manufacturers[code]
+	if !ok {
+		return Manufacturer{Code: code, Name: code}
+	}
+
+	m.Code = code
+	return m
+}
+
+type TelegramHeader struct {
+	Manufacturer Manufacturer
+	Model        string
+}
+
+func ParseTelegramHeader(h string) (TelegramHeader, error) {
+	if len(h) < 4 || h[3] < '0' || h[3] > '9' {
+		return TelegramHeader{}, ErrInvalidTelegramHeader
+	}
+
+	m := h[4:]
+	if strings.HasPrefix(m, `\`) {
+		m = m[1:]
+
+		// The enhanced identification character is not part of the model.
+		if len(m) > 0 && m[0] >= '0' && m[0] <= '9' {
+			m = m[1:]
+		}
+	}
+
+	return TelegramHeader{
+		Manufacturer: LookupManufacturer(h[:3]),
+		Model:        strings.TrimSpace(m),
+	}, nil
+}
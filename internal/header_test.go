@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTelegramHeader(t *testing.T) {
+	tests := []struct {
+		header       string
+		code         string
+		manufacturer string
+		model        string
+		err          error
+	}{
+		{`FLU5\253769484_A`, "FLU", "Fluvius", "53769484_A", nil},
+		{`ISk5\2MT382-1000`, "ISK", "Iskraemeco", "MT382-1000", nil},
+		{`KFM5KAIFA-METER`, "KFM", "Kaifa", "KAIFA-METER", nil},
+		{`XMX5LGBBFG1012345678`, "XMX", "Landis+Gyr", "LGBBFG1012345678", nil},
+		{`ABC5\2Model`, "ABC", "ABC", "Model", nil},
+		{`FLU`, "", "", "", ErrInvalidTelegramHeader},
+		{`FLUX\2Model`, "", "", "", ErrInvalidTelegramHeader},
+	}
+
+	for _, tt := range tests {
+		h, err := ParseTelegramHeader(tt.header)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseTelegramHeader(%q) error = %v, want %v", tt.header, err, tt.err)
+			continue
+		}
+
+		if h.Manufacturer.Code != tt.code ||
+			h.Manufacturer.Name != tt.manufacturer ||
+			h.Model != tt.model {
+			t.Errorf(
+				"ParseTelegramHeader(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.header,
+				h.Manufacturer.Code,
+				h.Manufacturer.Name,
+				h.Model,
+				tt.code,
+				tt.manufacturer,
+				tt.model,
+			)
+		}
+	}
+}
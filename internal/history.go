@@ -0,0 +1,560 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+	_ "modernc.org/sqlite" // registers the sqlite driver
+)
+
+const (
+	historyMaxPoints    = 10000
+	historySaveInterval = time.Minute
+)
+
+var (
+	ErrInvalidHistoryStep  = errors.New("invalid history step")
+	ErrInvalidHistoryRange = errors.New("invalid history range")
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS history (
+	resolution INTEGER NOT NULL,
+	start      INTEGER NOT NULL,
+	power_min  REAL NOT NULL,
+	power_avg  REAL NOT NULL,
+	power_max  REAL NOT NULL,
+	count      INTEGER NOT NULL,
+	gas        REAL,
+	PRIMARY KEY (resolution, start)
+);
+
+CREATE TABLE IF NOT EXISTS history_tariffs (
+	resolution INTEGER NOT NULL,
+	start      INTEGER NOT NULL,
+	tariff     INTEGER NOT NULL,
+	delivered  REAL NOT NULL,
+	injected   REAL NOT NULL,
+	PRIMARY KEY (resolution, start, tariff)
+);
+`
+
+type historyResolution struct {
+	Step     string
+	Duration time.Duration
+}
+
+var historyResolutions = []historyResolution{
+	{"1m", time.Minute},
+	{"15m", 15 * time.Minute},
+	{"1h", time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// Start returns the start of the bucket containing t, days start at midnight
+// in the meter's zone.
+func (r historyResolution) Start(t time.Time) time.Time {
+	if r.Duration == 24*time.Hour {
+		y, m, d := meterTime(t).Date()
+		return meterDate(y, m, d)
+	}
+
+	return t.Truncate(r.Duration)
+}
+
+// historyBucket accumulates the readings within a bucket. Counters are stored
+// as their last reading, deltas are derived from consecutive buckets so they
+// remain correct across restarts.
+type historyBucket struct {
+	Start     time.Time
+	Count     int
+	Sum       float64
+	Min       float64
+	Max       float64
+	Delivered map[int]Energy
+	Injected  map[int]Energy
+	Gas       *Volume
+}
+
+type HistoryConfig struct {
+	Path      string
+	Retention map[string]time.Duration
+}
+
+// History downsamples snapshots into an SQLite database at several
+// resolutions, each with its own retention.
+type History struct {
+	Logger      log.Logger
+	P1State     *P1State
+	TariffNames TariffNames
+	Config      HistoryConfig
+
+	db      *sql.DB
+	mutex   sync.Mutex
+	buckets map[string]*historyBucket
+}
+
+func (h *History) Start() {
+	c := h.P1State.Subscribe()
+
+	// Open buckets are saved as well, so they survive a crash.
+	t := time.NewTicker(historySaveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case s := <-c:
+			if err := h.update(s); err != nil {
+				h.Logger.Errorln("unable to update history:", err)
+			}
+
+		case <-t.C:
+			if err := h.saveBuckets(); err != nil {
+				h.Logger.Errorln("unable to save history:", err)
+			}
+		}
+	}
+}
+
+// Shutdown saves the open buckets and closes the database.
+func (h *History) Shutdown() {
+	if err := h.saveBuckets(); err != nil {
+		h.Logger.Errorln("unable to save history:", err)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := h.db.Close(); err != nil {
+		h.Logger.Errorln(err)
+	}
+}
+
+func (h *History) saveBuckets() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, r := range historyResolutions {
+		if b := h.buckets[r.Step]; b != nil {
+			if err := h.save(r, b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (h *History) update(s Snapshot) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if s.MeterTimestamp.IsZero() {
+		return nil
+	}
+
+	p := float64(s.ElectricPowerNet())
+	for _, r := range historyResolutions {
+		st := r.Start(s.MeterTimestamp)
+
+		b := h.buckets[r.Step]
+		if b != nil && !b.Start.Equal(st) {
+			if err := h.save(r, b); err != nil {
+				return err
+			}
+
+			b = nil
+		}
+
+		if b == nil {
+			var err error
+			if b, err = h.load(r, st, p); err != nil {
+				return err
+			}
+
+			h.buckets[r.Step] = b
+		}
+
+		b.Count++
+		b.Sum += p
+		b.Min = math.Min(b.Min, p)
+		b.Max = math.Max(b.Max, p)
+		b.Delivered = s.TotalElectricityDelivered
+		b.Injected = s.TotalElectricityInjected
+
+		if s.GasEquipmentIdentifier != "" {
+			v := s.TotalGasDelivered
+			b.Gas = &v
+		}
+	}
+
+	return nil
+}
+
+// load opens a bucket, continuing where it was saved before a restart.
+func (h *History) load(r historyResolution, st time.Time, p float64) (*historyBucket, error) {
+	b := &historyBucket{Start: st, Min: p, Max: p}
+
+	var avg float64
+	err := h.db.QueryRow(
+		`SELECT count, power_min, power_avg, power_max FROM history
+		WHERE resolution = ? AND start = ?`,
+		int64(r.Duration/time.Second),
+		st.Unix(),
+	).Scan(&b.Count, &b.Min, &avg, &b.Max)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return b, nil
+	case err != nil:
+		return nil, err
+	}
+
+	b.Sum = avg * float64(b.Count)
+	return b, nil
+}
+
+func (h *History) save(r historyResolution, b *historyBucket) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	res := int64(r.Duration / time.Second)
+	if _, err := tx.Exec(
+		`INSERT OR REPLACE INTO history
+		(resolution, start, power_min, power_avg, power_max, gas, count)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		res,
+		b.Start.Unix(),
+		b.Min,
+		b.Sum/float64(b.Count),
+		b.Max,
+		b.Gas,
+		b.Count,
+	); err != nil {
+		return err
+	}
+
+	for _, k := range TariffNames(nil).Tariffs(b.Delivered, b.Injected) {
+		if _, err := tx.Exec(
+			`INSERT OR REPLACE INTO history_tariffs VALUES (?, ?, ?, ?, ?)`,
+			res,
+			b.Start.Unix(),
+			k,
+			b.Delivered[k],
+			b.Injected[k],
+		); err != nil {
+			return err
+		}
+	}
+
+	if d := h.Config.Retention[r.Step]; d > 0 {
+		t := b.Start.Add(-d).Unix()
+		if _, err := tx.Exec(
+			`DELETE FROM history WHERE resolution = ? AND start < ?`,
+			res,
+			t,
+		); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			`DELETE FROM history_tariffs WHERE resolution = ? AND start < ?`,
+			res,
+			t,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type historyPoint struct {
+	Start     time.Time           `json:"start"`
+	PowerMin  quantity            `json:"power_min"`
+	PowerAvg  quantity            `json:"power_avg"`
+	PowerMax  quantity            `json:"power_max"`
+	Delivered map[string]quantity `json:"delivered,omitempty"`
+	Injected  map[string]quantity `json:"injected,omitempty"`
+	Gas       *quantity           `json:"gas,omitempty"`
+}
+
+type historyResponse struct {
+	From   time.Time      `json:"from"`
+	To     time.Time      `json:"to"`
+	Step   string         `json:"step"`
+	Points []historyPoint `json:"points"`
+}
+
+// Query returns the buckets of the given resolution which start within
+// [from, to), the current one as of when it was last saved. Counters are
+// returned as deltas with respect to the previous bucket, they are omitted if
+// there is none or if buckets are missing in between.
+func (h *History) Query(from, to time.Time, r historyResolution) ([]historyPoint, error) {
+	res := int64(r.Duration / time.Second)
+
+	// Include the preceding bucket to derive the first deltas.
+	var prev sql.NullInt64
+	if err := h.db.QueryRow(
+		`SELECT MAX(start) FROM history WHERE resolution = ? AND start < ?`,
+		res,
+		from.Unix(),
+	).Scan(&prev); err != nil {
+		return nil, err
+	}
+
+	lo := from.Unix()
+	if prev.Valid {
+		lo = prev.Int64
+	}
+
+	type counters struct {
+		start     int64
+		delivered map[int]float64
+		injected  map[int]float64
+		gas       sql.NullFloat64
+	}
+
+	rows, err := h.db.Query(
+		`SELECT start, tariff, delivered, injected FROM history_tariffs
+		WHERE resolution = ? AND start >= ? AND start < ?`,
+		res,
+		lo,
+		to.Unix(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	cs := make(map[int64]*counters)
+	get := func(t int64) *counters {
+		c, ok := cs[t]
+		if !ok {
+			c = &counters{delivered: make(map[int]float64), injected: make(map[int]float64)}
+			cs[t] = c
+		}
+
+		return c
+	}
+
+	for rows.Next() {
+		var (
+			t, k int64
+			d, i float64
+		)
+
+		if err := rows.Scan(&t, &k, &d, &i); err != nil {
+			return nil, err
+		}
+
+		get(t).delivered[int(k)] = d
+		get(t).injected[int(k)] = i
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = h.db.Query(
+		`SELECT start, power_min, power_avg, power_max, gas FROM history
+		WHERE resolution = ? AND start >= ? AND start < ? ORDER BY start`,
+		res,
+		lo,
+		to.Unix(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var (
+		ps   = []historyPoint{}
+		last *counters
+	)
+
+	for rows.Next() {
+		var pmin, pa, pmx float64
+
+		c := &counters{}
+		if err := rows.Scan(&c.start, &pmin, &pa, &pmx, &c.gas); err != nil {
+			return nil, err
+		}
+
+		t := c.start
+		if v, ok := cs[t]; ok {
+			c.delivered, c.injected = v.delivered, v.injected
+		}
+
+		if t < from.Unix() {
+			last = c
+			continue
+		}
+
+		p := historyPoint{
+			Start:    meterTime(time.Unix(t, 0)),
+			PowerMin: quantity{pmin, "W"},
+			PowerAvg: quantity{pa, "W"},
+			PowerMax: quantity{pmx, "W"},
+		}
+
+		if last != nil && last.start == r.Start(time.Unix(t, 0).Add(-time.Second)).Unix() {
+			p.Delivered = historyDeltas(c.delivered, last.delivered, h.TariffNames)
+			p.Injected = historyDeltas(c.injected, last.injected, h.TariffNames)
+
+			if c.gas.Valid && last.gas.Valid {
+				p.Gas = &quantity{c.gas.Float64 - last.gas.Float64, "m3"}
+			}
+		}
+
+		ps = append(ps, p)
+		last = c
+	}
+
+	return ps, rows.Err()
+}
+
+func historyDeltas(cur, prev map[int]float64, n TariffNames) map[string]quantity {
+	r := make(map[string]quantity, len(cur))
+	for k, v := range cur {
+		if p, ok := prev[k]; ok {
+			r[n.Name(k)] = quantity{v - p, "Wh"}
+		}
+	}
+
+	return r
+}
+
+func (h *History) ServeHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := parseHistoryTime(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		to = t
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := parseHistoryTime(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from = t
+	}
+
+	if !from.Before(to) {
+		http.Error(w, ErrInvalidHistoryRange.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := parseHistoryStep(q.Get("step"), to.Sub(from))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if to.Sub(from)/res.Duration > historyMaxPoints {
+		http.Error(w, ErrInvalidHistoryRange.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ps, err := h.Query(from, to, res)
+	if err != nil {
+		h.Logger.Errorln(err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(
+		w,
+		historyResponse{
+			From:   meterTime(from),
+			To:     meterTime(to),
+			Step:   res.Step,
+			Points: ps,
+		},
+	)
+}
+
+// parseHistoryStep looks up the resolution of a step. If none is given, the
+// finest one resulting in at most 1440 points is picked.
+func parseHistoryStep(s string, d time.Duration) (historyResolution, error) {
+	for _, r := range historyResolutions {
+		if s == r.Step || s == "" && d/r.Duration <= 1440 {
+			return r, nil
+		}
+	}
+
+	if s == "" {
+		return historyResolutions[len(historyResolutions)-1], nil
+	}
+
+	return historyResolution{}, ErrInvalidHistoryStep
+}
+
+// parseHistoryTime parses RFC 3339 timestamps as well as Unix timestamps.
+func parseHistoryTime(s string) (time.Time, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(v, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func NewHistory(
+	l log.Logger,
+	s *P1State,
+	n TariffNames,
+	c HistoryConfig,
+) (*History, error) {
+	db, err := sql.Open(
+		"sqlite",
+		"file:"+c.Path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)",
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &History{
+		Logger:      l,
+		P1State:     s,
+		TariffNames: n,
+		Config:      c,
+		db:          db,
+		buckets:     make(map[string]*historyBucket),
+	}, nil
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func newTestHistory(t *testing.T, p string) *History {
+	t.Helper()
+
+	h, err := NewHistory(log.Base(), nil, nil, HistoryConfig{Path: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestHistoryRestart(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "history.db")
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, cet)
+
+	snapshot := func(d time.Duration, w Power, e Energy) Snapshot {
+		return Snapshot{
+			MeterTimestamp:            ts.Add(d),
+			ElectricPowerDelivered:    w,
+			TotalElectricityDelivered: map[int]Energy{1: e},
+		}
+	}
+
+	h := newTestHistory(t, p)
+	for _, s := range []Snapshot{
+		snapshot(0, 100, 1000),
+		snapshot(10*time.Second, 300, 1001),
+	} {
+		if err := h.update(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h.Shutdown()
+
+	// The open buckets are continued after a restart.
+	h = newTestHistory(t, p)
+	defer h.Shutdown()
+
+	if err := h.update(snapshot(20*time.Second, 500, 1002)); err != nil {
+		t.Fatal(err)
+	}
+
+	b := h.buckets["1m"]
+	if b.Count != 3 || b.Sum != 900 || b.Min != 100 || b.Max != 500 {
+		t.Errorf("bucket = %+v, want 3 readings between 100 and 500 W", b)
+	}
+}
+
+func TestHistoryQueryGap(t *testing.T) {
+	h := newTestHistory(t, filepath.Join(t.TempDir(), "history.db"))
+	defer h.Shutdown()
+
+	r := historyResolutions[0]
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, cet)
+
+	// The third bucket follows a gap of a minute.
+	for i, d := range []time.Duration{0, time.Minute, 3 * time.Minute} {
+		b := &historyBucket{
+			Start:     ts.Add(d),
+			Count:     1,
+			Delivered: map[int]Energy{1: Energy(1000 + 10*i)},
+			Injected:  map[int]Energy{1: 0},
+		}
+
+		if err := h.save(r, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ps, err := h.Query(ts.Add(time.Minute), ts.Add(time.Hour), r)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	if len(ps) != 2 {
+		t.Fatalf("Query() = %d points, want 2", len(ps))
+	}
+
+	if v := ps[0].Delivered["1"].Value; v != 10 {
+		t.Errorf("delivered = %v, want 10", v)
+	}
+
+	if ps[1].Delivered != nil {
+		t.Errorf("delivered = %v after a gap, want none", ps[1].Delivered)
+	}
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var homeAssistantIDRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+type homeAssistantDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+	ViaDevice    string   `json:"via_device,omitempty"`
+}
+
+type homeAssistantSensor struct {
+	Name              string              `json:"name"`
+	UniqueID          string              `json:"unique_id"`
+	ObjectID          string              `json:"object_id"`
+	StateTopic        string              `json:"state_topic"`
+	AvailabilityTopic string              `json:"availability_topic"`
+	DeviceClass       string              `json:"device_class,omitempty"`
+	StateClass        string              `json:"state_class,omitempty"`
+	Unit              string              `json:"unit_of_measurement,omitempty"`
+	Options           []string            `json:"options,omitempty"`
+	Device            homeAssistantDevice `json:"device"`
+}
+
+// homeAssistantClasses maps units onto Home Assistant's device and state
+// classes, which the energy dashboard relies on.
+var homeAssistantClasses = map[string][2]string{
+	"W":    {"power", "measurement"},
+	"Wh":   {"energy", "total_increasing"},
+	"A":    {"current", "measurement"},
+	"V":    {"voltage", "measurement"},
+	"VA":   {"apparent_power", "measurement"},
+	"m3":   {"gas", "total_increasing"},
+	"m3/h": {"volume_flow_rate", "measurement"},
+}
+
+var homeAssistantUnits = map[string]string{
+	"m3":   "m³",
+	"m3/h": "m³/h",
+}
+
+func (p *MQTTPublisher) onHomeAssistantStatus(_ mqtt.Client, m mqtt.Message) {
+	if string(m.Payload()) != mqttOnline {
+		return
+	}
+
+	// Home Assistant restarted, so the discovery messages are published
+	// again with the next snapshot.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.discovered = nil
+}
+
+func (p *MQTTPublisher) publishDiscovery(s Snapshot, fs []Field) {
+	if s.EquipmentIdentifier == "" {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.discovered == nil {
+		p.discovered = make(map[string]struct{})
+	}
+
+	for _, f := range fs {
+		id := homeAssistantID(f.Subsystem + "_" + f.Key())
+		if _, ok := p.discovered[id]; ok {
+			continue
+		}
+
+		b, err := json.Marshal(p.homeAssistantSensor(s, f, id))
+		if err != nil {
+			p.Logger.Errorln(err)
+			continue
+		}
+
+		t := strings.Join(
+			[]string{
+				p.Config.HomeAssistantPrefix,
+				"sensor",
+				homeAssistantID("p1_" + s.EquipmentIdentifier),
+				id,
+				"config",
+			},
+			"/",
+		)
+
+		p.publish(t, true, b)
+		p.discovered[id] = struct{}{}
+	}
+}
+
+func (p *MQTTPublisher) homeAssistantSensor(s Snapshot, f Field, id string) homeAssistantSensor {
+	// The object ID includes the equipment identifier as well, so entities of
+	// several meters don't collide.
+	u := homeAssistantID("p1_" + s.EquipmentIdentifier + "_" + id)
+
+	v := homeAssistantSensor{
+		Name:              homeAssistantName(f),
+		UniqueID:          u,
+		ObjectID:          u,
+		StateTopic:        p.fieldTopic(f),
+		AvailabilityTopic: p.AvailabilityTopic(),
+		Device: homeAssistantDevice{
+			Identifiers:  []string{homeAssistantID("p1_" + s.EquipmentIdentifier)},
+			Name:         "Smart Meter",
+			Manufacturer: s.Header.Manufacturer.Name,
+			Model:        s.Header.Model,
+			SerialNumber: s.EquipmentIdentifier,
+			SWVersion:    "DSMR " + s.Version.String(),
+		},
+	}
+
+	if f.Subsystem == "gas" {
+		v.Device = homeAssistantDevice{
+			Identifiers:  []string{homeAssistantID("p1_" + s.GasEquipmentIdentifier)},
+			Name:         "Gas Meter",
+			SerialNumber: s.GasEquipmentIdentifier,
+			ViaDevice:    homeAssistantID("p1_" + s.EquipmentIdentifier),
+		}
+	}
+
+	switch {
+	case f.State != "":
+		// Tariffs aren't known upfront, these are published as plain text.
+		if o := homeAssistantOptions(f); len(o) > 0 {
+			v.DeviceClass = "enum"
+			v.Options = o
+		}
+
+	case f.Unit == s.Currency:
+		v.DeviceClass = "monetary"
+		v.StateClass = "total"
+		v.Unit = f.Unit
+
+	default:
+		c := homeAssistantClasses[f.Unit]
+		v.DeviceClass = c[0]
+		v.StateClass = c[1]
+		v.Unit = f.Unit
+
+		if u, ok := homeAssistantUnits[f.Unit]; ok {
+			v.Unit = u
+		}
+	}
+
+	// Net energy decreases while injecting.
+	if f.Name == "net" {
+		v.StateClass = "total"
+	}
+
+	return v
+}
+
+func homeAssistantOptions(f Field) []string {
+	var o []string
+	switch f.Name {
+	case "breaker_state":
+		for _, v := range BreakerStates {
+			o = append(o, v.String())
+		}
+
+	case "valve_state":
+		for _, v := range GasValveStates {
+			o = append(o, v.String())
+		}
+	}
+
+	return o
+}
+
+func homeAssistantName(f Field) string {
+	n := strings.ReplaceAll(f.Name, "_", " ")
+	if f.Subsystem == "gas" {
+		n = "gas " + n
+	}
+
+	if f.Tariff != "" {
+		n += " " + f.Tariff
+	}
+
+	if f.Phase != "" {
+		n += " " + strings.ToUpper(f.Phase)
+	}
+
+	return strings.ToUpper(n[:1]) + n[1:]
+}
+
+func homeAssistantID(s string) string {
+	return strings.ToLower(homeAssistantIDRegex.ReplaceAllString(s, "_"))
+}
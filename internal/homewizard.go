@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"crypto/sha1" // #nosec G505 -- only used to derive a stable serial number
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type homeWizardDeviceResponse struct {
+	ProductType     string `json:"product_type"`
+	ProductName     string `json:"product_name"`
+	Serial          string `json:"serial"`
+	FirmwareVersion string `json:"firmware_version"`
+	APIVersion      string `json:"api_version"`
+}
+
+type homeWizardDataResponse struct {
+	SMRVersion                int      `json:"smr_version"`
+	MeterModel                string   `json:"meter_model"`
+	UniqueID                  string   `json:"unique_id"`
+	ActiveTariff              int      `json:"active_tariff"`
+	TotalPowerImportKWh       float64  `json:"total_power_import_kwh"`
+	TotalPowerImportT1KWh     *float64 `json:"total_power_import_t1_kwh,omitempty"`
+	TotalPowerImportT2KWh     *float64 `json:"total_power_import_t2_kwh,omitempty"`
+	TotalPowerExportKWh       float64  `json:"total_power_export_kwh"`
+	TotalPowerExportT1KWh     *float64 `json:"total_power_export_t1_kwh,omitempty"`
+	TotalPowerExportT2KWh     *float64 `json:"total_power_export_t2_kwh,omitempty"`
+	ActivePowerW              float64  `json:"active_power_w"`
+	ActivePowerL1W            *float64 `json:"active_power_l1_w,omitempty"`
+	ActivePowerL2W            *float64 `json:"active_power_l2_w,omitempty"`
+	ActivePowerL3W            *float64 `json:"active_power_l3_w,omitempty"`
+	ActiveVoltageL1V          *float64 `json:"active_voltage_l1_v,omitempty"`
+	ActiveVoltageL2V          *float64 `json:"active_voltage_l2_v,omitempty"`
+	ActiveVoltageL3V          *float64 `json:"active_voltage_l3_v,omitempty"`
+	ActiveCurrentL1A          *float64 `json:"active_current_l1_a,omitempty"`
+	ActiveCurrentL2A          *float64 `json:"active_current_l2_a,omitempty"`
+	ActiveCurrentL3A          *float64 `json:"active_current_l3_a,omitempty"`
+	ActivePowerAverageW       float64  `json:"active_power_average_w"`
+	MonthlyPowerPeakW         *float64 `json:"montly_power_peak_w,omitempty"`
+	MonthlyPowerPeakTimestamp *int64   `json:"montly_power_peak_timestamp,omitempty"`
+	TotalGasM3                *float64 `json:"total_gas_m3,omitempty"`
+	GasTimestamp              *int64   `json:"gas_timestamp,omitempty"`
+	GasUniqueID               string   `json:"gas_unique_id,omitempty"`
+}
+
+// HomeWizardAPI emulates the local API of the HomeWizard Wi-Fi P1 meter, so
+// that tools which support it can use the exporter instead.
+type HomeWizardAPI struct {
+	P1State         *P1State
+	FirmwareVersion string
+}
+
+func (a *HomeWizardAPI) Handler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/api", a.serveDevice)
+	m.HandleFunc("/api/v1/data", a.serveData)
+	m.HandleFunc("/api/v1/telegram", a.serveTelegram)
+
+	return m
+}
+
+func (a *HomeWizardAPI) serveDevice(w http.ResponseWriter, r *http.Request) {
+	s := a.P1State.Snapshot()
+	if s.EquipmentIdentifier == "" {
+		http.Error(w, "no telegram received", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The serial number is derived from the equipment identifier, so that
+	// it remains stable across restarts.
+	h := sha1.Sum([]byte(s.EquipmentIdentifier)) // #nosec G401
+
+	writeJSON(
+		w,
+		homeWizardDeviceResponse{
+			ProductType:     "HWE-P1",
+			ProductName:     "P1 meter",
+			Serial:          hex.EncodeToString(h[:6]),
+			FirmwareVersion: a.FirmwareVersion,
+			APIVersion:      "v1",
+		},
+	)
+}
+
+func (a *HomeWizardAPI) serveData(w http.ResponseWriter, r *http.Request) {
+	s := a.P1State.Snapshot()
+	if s.Timestamp.IsZero() {
+		http.Error(w, "no telegram received", http.StatusServiceUnavailable)
+		return
+	}
+
+	v := homeWizardDataResponse{
+		SMRVersion:          int(s.Version.Major()),
+		MeterModel:          strings.TrimSpace(s.Header.Manufacturer.Name + " " + s.Header.Model),
+		UniqueID:            homeWizardUniqueID(s.RawEquipmentIdentifier, s.EquipmentIdentifier),
+		ActiveTariff:        s.ElectricityTariffIndicator,
+		ActivePowerW:        float64(s.ElectricPowerNet()),
+		ActivePowerL1W:      optionalPhasePower(s, "l1"),
+		ActivePowerL2W:      optionalPhasePower(s, "l2"),
+		ActivePowerL3W:      optionalPhasePower(s, "l3"),
+		ActiveVoltageL1V:    optionalFloat(s.Voltage, "l1"),
+		ActiveVoltageL2V:    optionalFloat(s.Voltage, "l2"),
+		ActiveVoltageL3V:    optionalFloat(s.Voltage, "l3"),
+		ActiveCurrentL1A:    optionalFloat(s.ElectricCurrent, "l1"),
+		ActiveCurrentL2A:    optionalFloat(s.ElectricCurrent, "l2"),
+		ActiveCurrentL3A:    optionalFloat(s.ElectricCurrent, "l3"),
+		ActivePowerAverageW: float64(s.ElectricityDemand),
+	}
+
+	for _, e := range s.TotalElectricityDelivered {
+		v.TotalPowerImportKWh += float64(e) / 1000
+	}
+
+	for _, e := range s.TotalElectricityInjected {
+		v.TotalPowerExportKWh += float64(e) / 1000
+	}
+
+	v.TotalPowerImportT1KWh = optionalKWh(s.TotalElectricityDelivered, 1)
+	v.TotalPowerImportT2KWh = optionalKWh(s.TotalElectricityDelivered, 2)
+	v.TotalPowerExportT1KWh = optionalKWh(s.TotalElectricityInjected, 1)
+	v.TotalPowerExportT2KWh = optionalKWh(s.TotalElectricityInjected, 2)
+
+	if !s.ElectricityDemandPeakTime.IsZero() {
+		p := float64(s.ElectricityDemandPeak)
+		t := homeWizardTimestamp(s.ElectricityDemandPeakTime)
+
+		v.MonthlyPowerPeakW = &p
+		v.MonthlyPowerPeakTimestamp = &t
+	}
+
+	if s.GasEquipmentIdentifier != "" {
+		g := float64(s.TotalGasDelivered)
+		t := homeWizardTimestamp(s.TotalGasDeliveredTimestamp)
+
+		v.TotalGasM3 = &g
+		v.GasTimestamp = &t
+		v.GasUniqueID = homeWizardUniqueID(s.RawGasEquipmentIdentifier, s.GasEquipmentIdentifier)
+	}
+
+	writeJSON(w, v)
+}
+
+func (a *HomeWizardAPI) serveTelegram(w http.ResponseWriter, r *http.Request) {
+	t := a.P1State.Telegram()
+	if t == nil {
+		http.Error(w, "no telegram received", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := w.Write([]byte(t.Raw)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func NewHomeWizardAPI(s *P1State, v string) *HomeWizardAPI {
+	return &HomeWizardAPI{
+		P1State:         s,
+		FirmwareVersion: v,
+	}
+}
+
+func optionalFloat[V ~float64](m map[string]V, k string) *float64 {
+	v, ok := m[k]
+	if !ok {
+		return nil
+	}
+
+	f := float64(v)
+	return &f
+}
+
+// optionalPhasePower returns the power delivered minus the power injected on
+// a phase, if the meter reports it.
+func optionalPhasePower(s Snapshot, k string) *float64 {
+	v, ok := s.PhasePowerDelivered[k]
+	if !ok {
+		return nil
+	}
+
+	f := float64(v - s.PhasePowerInjected[k])
+	return &f
+}
+
+func optionalKWh(m map[int]Energy, k int) *float64 {
+	v, ok := m[k]
+	if !ok {
+		return nil
+	}
+
+	f := float64(v) / 1000
+	return &f
+}
+
+// homeWizardUniqueID returns the identifier as the meter sent it, which is
+// hex-encoded. Checkpoints from before the raw identifier was kept only hold
+// the decoded one.
+func homeWizardUniqueID(raw, id string) string {
+	if raw == "" {
+		raw = hex.EncodeToString([]byte(id))
+	}
+
+	return strings.ToUpper(raw)
+}
+
+// homeWizardTimestamp formats a time as the meter would, e.g. 230101120000.
+func homeWizardTimestamp(t time.Time) int64 {
+	v, _ := strconv.ParseInt(t.Format("060102150405"), 10, 64)
+	return v
+}
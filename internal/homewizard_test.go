@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+func homeWizardGet(t *testing.T, h http.Handler, path string) map[string]interface{} {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want %d", path, w.Code, http.StatusOK)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("GET %s: json.Unmarshal() error = %v", path, err)
+	}
+
+	return v
+}
+
+func TestHomeWizardAPI(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	err := s.handleTelegram(ParseTelegram(
+		"/Ene5\\T210-D ESMR5.0\r\n" +
+			"\r\n" +
+			"1-3:0.2.8(50)\r\n" +
+			"0-0:1.0.0(210204163628W)\r\n" +
+			"0-0:96.1.1(4530303336303030303439353530303138)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n" +
+			"1-0:1.8.2(000200.000*kWh)\r\n" +
+			"1-0:2.8.1(000010.000*kWh)\r\n" +
+			"1-0:2.8.2(000020.000*kWh)\r\n" +
+			"0-0:96.14.0(0002)\r\n" +
+			"1-0:1.7.0(00.700*kW)\r\n" +
+			"1-0:2.7.0(00.000*kW)\r\n" +
+			"1-0:32.7.0(230.1*V)\r\n" +
+			"1-0:31.7.0(003*A)\r\n" +
+			"1-0:21.7.0(00.500*kW)\r\n" +
+			"1-0:41.7.0(00.200*kW)\r\n" +
+			"1-0:22.7.0(00.000*kW)\r\n" +
+			"1-0:42.7.0(00.100*kW)\r\n" +
+			"0-1:24.1.0(003)\r\n" +
+			"0-1:96.1.0(3232323241424344313233343536373839)\r\n" +
+			"0-1:24.2.1(210204163500W)(00042.000*m3)\r\n" +
+			"!1234\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	h := NewHomeWizardAPI(s, "1.0.0").Handler()
+
+	t.Run("device", func(t *testing.T) {
+		v := homeWizardGet(t, h, "/api")
+
+		want := []string{"api_version", "firmware_version", "product_name", "product_type", "serial"}
+		if k := jsonKeys(v); !reflect.DeepEqual(k, want) {
+			t.Errorf("keys = %v, want %v", k, want)
+		}
+
+		if v["product_type"] != "HWE-P1" || v["api_version"] != "v1" {
+			t.Errorf("device = %v", v)
+		}
+	})
+
+	t.Run("data", func(t *testing.T) {
+		v := homeWizardGet(t, h, "/api/v1/data")
+
+		want := map[string]interface{}{
+			"smr_version":               50.0,
+			"meter_model":               "Sagemcom T210-D ESMR5.0",
+			"unique_id":                 "4530303336303030303439353530303138",
+			"active_tariff":             2.0,
+			"total_power_import_kwh":    323.456,
+			"total_power_import_t1_kwh": 123.456,
+			"total_power_import_t2_kwh": 200.0,
+			"total_power_export_kwh":    30.0,
+			"total_power_export_t1_kwh": 10.0,
+			"total_power_export_t2_kwh": 20.0,
+			"active_power_w":            700.0,
+			"active_power_l1_w":         500.0,
+			"active_power_l2_w":         100.0,
+			"active_voltage_l1_v":       230.1,
+			"active_current_l1_a":       3.0,
+			"active_power_average_w":    0.0,
+			"total_gas_m3":              42.0,
+			"gas_timestamp":             210204163500.0,
+			"gas_unique_id":             "3232323241424344313233343536373839",
+		}
+
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("data = %v, want %v", v, want)
+		}
+	})
+}
+
+func jsonKeys(v map[string]interface{}) []string {
+	k := make([]string, 0, len(v))
+	for s := range v {
+		k = append(k, s)
+	}
+
+	sort.Strings(k)
+	return k
+}
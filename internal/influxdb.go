@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+const (
+	influxDBTimeout    = 10 * time.Second
+	influxDBMaxBackoff = 5 * time.Minute
+)
+
+var (
+	ErrInvalidInfluxDBBatchSize  = errors.New("invalid InfluxDB batch size")
+	ErrInvalidInfluxDBBufferSize = errors.New("InfluxDB buffer size is smaller than the batch size")
+	ErrInvalidInfluxDBInterval   = errors.New("invalid InfluxDB flush interval")
+)
+
+var (
+	influxDBMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxDBKeyEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	influxDBStringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+type InfluxDBConfig struct {
+	URL           string
+	Org           string
+	Bucket        string
+	Token         string
+	BatchSize     int
+	BufferSize    int
+	FlushInterval time.Duration
+}
+
+// InfluxDBWriter writes every snapshot to InfluxDB 2 in line protocol. Lines
+// are buffered in memory while the server is unavailable, dropping the oldest
+// ones once the buffer is full.
+type InfluxDBWriter struct {
+	Logger      log.Logger
+	P1State     *P1State
+	TariffNames TariffNames
+	Config      InfluxDBConfig
+
+	client  *http.Client
+	mutex   sync.Mutex
+	buffer  []string
+	dropped int
+	full    chan struct{}
+}
+
+func (w *InfluxDBWriter) Start() {
+	go w.flushes()
+
+	c := w.P1State.Subscribe()
+	for s := range c {
+		w.append(w.lines(s))
+	}
+}
+
+func (w *InfluxDBWriter) append(ls []string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buffer = append(w.buffer, ls...)
+	w.trim()
+
+	if len(w.buffer) >= w.Config.BatchSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *InfluxDBWriter) trim() {
+	if n := len(w.buffer) - w.Config.BufferSize; n > 0 {
+		w.buffer = w.buffer[n:]
+		w.dropped += n
+	}
+}
+
+func (w *InfluxDBWriter) flushes() {
+	d := w.Config.FlushInterval
+	for {
+		// Don't flush early while backing off, the server is unavailable.
+		var full <-chan struct{}
+		if d == w.Config.FlushInterval {
+			full = w.full
+		}
+
+		select {
+		case <-time.After(d):
+		case <-full:
+		}
+
+		if err := w.flush(); err != nil {
+			w.Logger.Errorln("unable to write to InfluxDB:", err)
+			d = min(2*d, influxDBMaxBackoff)
+			continue
+		}
+
+		d = w.Config.FlushInterval
+	}
+}
+
+func (w *InfluxDBWriter) flush() error {
+	for {
+		w.mutex.Lock()
+		if w.dropped > 0 {
+			w.Logger.Warnf("dropped %d lines, the InfluxDB buffer is full", w.dropped)
+			w.dropped = 0
+		}
+
+		n := min(len(w.buffer), w.Config.BatchSize)
+		b := w.buffer[:n:n]
+		w.buffer = w.buffer[n:]
+		w.mutex.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		retry, err := w.write(b)
+		if err == nil {
+			continue
+		}
+
+		if retry {
+			w.mutex.Lock()
+			w.buffer = append(b, w.buffer...)
+			w.trim()
+			w.mutex.Unlock()
+		}
+
+		return err
+	}
+}
+
+// write sends a batch of lines to InfluxDB, reporting whether the batch
+// should be retried when it fails.
+func (w *InfluxDBWriter) write(ls []string) (bool, error) {
+	u, err := url.Parse(strings.TrimSuffix(w.Config.URL, "/") + "/api/v2/write")
+	if err != nil {
+		return false, err
+	}
+
+	u.RawQuery = url.Values{
+		"org":       {w.Config.Org},
+		"bucket":    {w.Config.Bucket},
+		"precision": {"s"},
+	}.Encode()
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		u.String(),
+		strings.NewReader(strings.Join(ls, "\n")),
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.Config.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.Config.Token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(b))
+
+	// Rejected lines won't be accepted the next time either.
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
+
+// lines converts a snapshot into line protocol, with a point for every
+// combination of subsystem, tariff and phase.
+func (w *InfluxDBWriter) lines(s Snapshot) []string {
+	if s.Timestamp.IsZero() {
+		return nil
+	}
+
+	type point struct {
+		tags      string
+		fields    []string
+		timestamp time.Time
+	}
+
+	var ps []*point
+	idx := make(map[string]*point)
+
+	for _, f := range s.Fields(w.TariffNames) {
+		id, ts := s.EquipmentIdentifier, s.MeterTimestamp
+		if f.Subsystem == "gas" {
+			id = s.GasEquipmentIdentifier
+			if !s.TotalGasDeliveredTimestamp.IsZero() {
+				ts = s.TotalGasDeliveredTimestamp
+			}
+		}
+
+		t := influxDBMeasurementEscaper.Replace(f.Subsystem)
+		if id != "" {
+			t += ",equipment_id=" + influxDBKeyEscaper.Replace(id)
+		}
+
+		if f.Phase != "" {
+			t += ",phase=" + influxDBKeyEscaper.Replace(f.Phase)
+		}
+
+		if f.Tariff != "" {
+			t += ",tariff=" + influxDBKeyEscaper.Replace(f.Tariff)
+		}
+
+		p, ok := idx[t]
+		if !ok {
+			p = &point{tags: t, timestamp: ts}
+			idx[t] = p
+			ps = append(ps, p)
+		}
+
+		v := strconv.FormatFloat(f.Value, 'f', -1, 64)
+		if f.State != "" {
+			v = `"` + influxDBStringEscaper.Replace(f.State) + `"`
+		}
+
+		p.fields = append(p.fields, influxDBKeyEscaper.Replace(f.Name)+"="+v)
+	}
+
+	ls := make([]string, 0, len(ps))
+	for _, p := range ps {
+		ls = append(
+			ls,
+			p.tags+" "+strings.Join(p.fields, ",")+" "+strconv.FormatInt(p.timestamp.Unix(), 10),
+		)
+	}
+
+	return ls
+}
+
+func NewInfluxDBWriter(
+	l log.Logger,
+	s *P1State,
+	n TariffNames,
+	c InfluxDBConfig,
+) (*InfluxDBWriter, error) {
+	if c.BatchSize < 1 {
+		return nil, ErrInvalidInfluxDBBatchSize
+	}
+
+	if c.BufferSize < c.BatchSize {
+		return nil, ErrInvalidInfluxDBBufferSize
+	}
+
+	if c.FlushInterval <= 0 {
+		return nil, ErrInvalidInfluxDBInterval
+	}
+
+	return &InfluxDBWriter{
+		Logger:      l,
+		P1State:     s,
+		TariffNames: n,
+		Config:      c,
+		client:      &http.Client{Timeout: influxDBTimeout},
+		full:        make(chan struct{}, 1),
+	}, nil
+}
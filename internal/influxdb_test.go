@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestNewInfluxDBWriter(t *testing.T) {
+	tests := []struct {
+		batch    int
+		buffer   int
+		interval time.Duration
+		err      error
+	}{
+		{500, 100000, time.Second, nil},
+		{1, 1, time.Second, nil},
+		{0, 100000, time.Second, ErrInvalidInfluxDBBatchSize},
+		{-1, 100000, time.Second, ErrInvalidInfluxDBBatchSize},
+		{500, 499, time.Second, ErrInvalidInfluxDBBufferSize},
+		{500, 100000, 0, ErrInvalidInfluxDBInterval},
+		{500, 100000, -time.Second, ErrInvalidInfluxDBInterval},
+	}
+
+	for _, tt := range tests {
+		_, err := NewInfluxDBWriter(
+			log.Base(),
+			nil,
+			nil,
+			InfluxDBConfig{
+				BatchSize:     tt.batch,
+				BufferSize:    tt.buffer,
+				FlushInterval: tt.interval,
+			},
+		)
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("NewInfluxDBWriter(%d, %d, %v) error = %v, want %v", tt.batch, tt.buffer, tt.interval, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+const (
+	modbusIdleTimeout  = time.Minute
+	modbusMaxQuantity  = 125
+	modbusMaxPDULength = 253
+
+	modbusReadHoldingRegisters = 0x03
+	modbusReadInputRegisters   = 0x04
+
+	modbusIllegalFunction    = 0x01
+	modbusIllegalDataAddress = 0x02
+	modbusIllegalDataValue   = 0x03
+	modbusDeviceFailure      = 0x04
+)
+
+// SunSpec register map, starting with the well-known marker at 40000 and
+// followed by the common model, the wye-connect three phase meter model using
+// integers and scale factors, and the end marker.
+const (
+	sunSpecBase = 40000
+
+	sunSpecCommonModel      = 1
+	sunSpecCommonLength     = 66
+	sunSpecMeterModel       = 203
+	sunSpecMeterLength      = 105
+	sunSpecEndModel         = 0xffff
+	sunSpecNotImplemented16 = 0x8000
+
+	sunSpecCurrentScale     = -2
+	sunSpecVoltageScale     = -1
+	sunSpecPowerScale       = 0
+	sunSpecPowerFactorScale = -1
+	sunSpecEnergyScale      = 0
+)
+
+var sunSpecPhases = []string{"l1", "l2", "l3"}
+
+// ModbusServer is a read-only Modbus TCP server which presents the smart meter
+// as a SunSpec meter, for inverters and batteries which expect a grid meter.
+// Power is positive when importing from the grid.
+type ModbusServer struct {
+	Logger  log.Logger
+	P1State *P1State
+	Version string
+}
+
+func (m *ModbusServer) Serve(l net.Listener) error {
+	return accept(m.Logger, l, m.serve)
+}
+
+func (m *ModbusServer) serve(c net.Conn) {
+	defer c.Close()
+
+	h := make([]byte, 7)
+	for {
+		if err := c.SetReadDeadline(time.Now().Add(modbusIdleTimeout)); err != nil {
+			return
+		}
+
+		if _, err := io.ReadFull(c, h); err != nil {
+			return
+		}
+
+		// The length covers the unit identifier and the PDU.
+		n := int(binary.BigEndian.Uint16(h[4:]))
+		if binary.BigEndian.Uint16(h[2:]) != 0 || n < 2 || n > modbusMaxPDULength+1 {
+			return
+		}
+
+		pdu := make([]byte, n-1)
+		if _, err := io.ReadFull(c, pdu); err != nil {
+			return
+		}
+
+		r := m.handle(pdu)
+
+		b := make([]byte, 7, 7+len(r))
+		copy(b, h[:4])
+		binary.BigEndian.PutUint16(b[4:], uint16(len(r)+1))
+		b[6] = h[6]
+
+		if _, err := c.Write(append(b, r...)); err != nil {
+			return
+		}
+	}
+}
+
+func (m *ModbusServer) handle(pdu []byte) []byte {
+	fc := pdu[0]
+	if fc != modbusReadHoldingRegisters && fc != modbusReadInputRegisters {
+		return modbusException(fc, modbusIllegalFunction)
+	}
+
+	if len(pdu) != 5 {
+		return modbusException(fc, modbusIllegalDataValue)
+	}
+
+	a := int(binary.BigEndian.Uint16(pdu[1:]))
+	n := int(binary.BigEndian.Uint16(pdu[3:]))
+	if n < 1 || n > modbusMaxQuantity {
+		return modbusException(fc, modbusIllegalDataValue)
+	}
+
+	// Don't let devices act on stale readings.
+	s := m.P1State.Snapshot()
+	if !s.Up() {
+		return modbusException(fc, modbusDeviceFailure)
+	}
+
+	regs := m.registers(s)
+	if a < sunSpecBase || a+n > sunSpecBase+len(regs) {
+		return modbusException(fc, modbusIllegalDataAddress)
+	}
+
+	r := []byte{fc, byte(2 * n)}
+	for _, v := range regs[a-sunSpecBase : a-sunSpecBase+n] {
+		r = binary.BigEndian.AppendUint16(r, v)
+	}
+
+	return r
+}
+
+func (m *ModbusServer) registers(s Snapshot) []uint16 {
+	r := []uint16{0x5375, 0x6e53}
+
+	r = append(r, sunSpecCommonModel, sunSpecCommonLength)
+	r = appendSunSpecString(r, s.Header.Manufacturer.Name, 16)
+	r = appendSunSpecString(r, s.Header.Model, 16)
+	r = appendSunSpecString(r, "DSMR "+s.Version.String(), 8)
+	r = appendSunSpecString(r, m.Version, 8)
+	r = appendSunSpecString(r, s.EquipmentIdentifier, 16)
+	r = append(r, 1, sunSpecNotImplemented16)
+
+	var (
+		ap       = s.ApparentPower()
+		current  ElectricCurrent
+		voltage  Voltage
+		apparent ApparentPower
+	)
+
+	for _, k := range sunSpecPhases {
+		current += s.ElectricCurrent[k]
+		apparent += ap[k]
+	}
+
+	for _, v := range s.Voltage {
+		voltage += v / Voltage(len(s.Voltage))
+	}
+
+	power := make(map[string]Power)
+	pf := make(map[string]float64)
+	for k, v := range s.PhasePowerDelivered {
+		power[k] = v - s.PhasePowerInjected[k]
+		pf[k] = 100 * powerFactor(v, s.PhasePowerInjected[k], ap[k])
+	}
+
+	r = append(r, sunSpecMeterModel, sunSpecMeterLength)
+
+	// Current
+	r = append(r, sunSpecInt(float64(current), sunSpecCurrentScale))
+	r = appendSunSpecPhases(r, s.ElectricCurrent, sunSpecCurrentScale)
+	r = append(r, sunSpecScale(sunSpecCurrentScale))
+
+	// Voltage, line to neutral followed by line to line
+	r = append(r, sunSpecInt(float64(voltage), sunSpecVoltageScale))
+	r = appendSunSpecPhases(r, s.Voltage, sunSpecVoltageScale)
+	r = append(r, sunSpecNotImplemented(4)...)
+	r = append(r, sunSpecScale(sunSpecVoltageScale))
+
+	// Frequency
+	r = append(r, sunSpecNotImplemented(2)...)
+
+	// Real power
+	r = append(
+		r,
+		sunSpecInt(float64(s.ElectricPowerDelivered-s.ElectricPowerInjected), sunSpecPowerScale),
+	)
+
+	r = appendSunSpecPhases(r, power, sunSpecPowerScale)
+	r = append(r, sunSpecScale(sunSpecPowerScale))
+
+	// Apparent power
+	r = append(r, sunSpecInt(float64(apparent), sunSpecPowerScale))
+	r = appendSunSpecPhases(r, ap, sunSpecPowerScale)
+	r = append(r, sunSpecScale(sunSpecPowerScale))
+
+	// Reactive power
+	r = append(r, sunSpecNotImplemented(5)...)
+
+	// Power factor
+	r = append(
+		r,
+		sunSpecInt(
+			100*powerFactor(s.ElectricPowerDelivered, s.ElectricPowerInjected, apparent),
+			sunSpecPowerFactorScale,
+		),
+	)
+
+	r = appendSunSpecPhases(r, pf, sunSpecPowerFactorScale)
+	r = append(r, sunSpecScale(sunSpecPowerFactorScale))
+
+	// Real energy, exported followed by imported, the meter only has counters
+	// for the totals. Unaccumulated counters are zero.
+	var delivered, injected Energy
+	for _, v := range s.TotalElectricityDelivered {
+		delivered += v
+	}
+
+	for _, v := range s.TotalElectricityInjected {
+		injected += v
+	}
+
+	r = appendSunSpecAcc32(r, float64(injected), sunSpecEnergyScale)
+	r = append(r, make([]uint16, 6)...)
+	r = appendSunSpecAcc32(r, float64(delivered), sunSpecEnergyScale)
+	r = append(r, make([]uint16, 6)...)
+	r = append(r, sunSpecScale(sunSpecEnergyScale))
+
+	// Apparent and reactive energy
+	r = append(r, make([]uint16, 16)...)
+	r = append(r, sunSpecNotImplemented16)
+	r = append(r, make([]uint16, 32)...)
+	r = append(r, sunSpecNotImplemented16)
+
+	// Events
+	r = append(r, 0, 0)
+
+	return append(r, sunSpecEndModel, 0)
+}
+
+func appendSunSpecString(r []uint16, s string, n int) []uint16 {
+	b := make([]byte, 2*n)
+	copy(b, s)
+
+	for i := 0; i < n; i++ {
+		r = append(r, binary.BigEndian.Uint16(b[2*i:]))
+	}
+
+	return r
+}
+
+// appendSunSpecPhases appends a value for every phase, phases which the meter
+// doesn't report aren't implemented.
+func appendSunSpecPhases[V ~float64](r []uint16, m map[string]V, sf int) []uint16 {
+	for _, k := range sunSpecPhases {
+		v, ok := m[k]
+		if !ok {
+			r = append(r, sunSpecNotImplemented16)
+			continue
+		}
+
+		r = append(r, sunSpecInt(float64(v), sf))
+	}
+
+	return r
+}
+
+func appendSunSpecAcc32(r []uint16, v float64, sf int) []uint16 {
+	u := uint32(math.Round(v / math.Pow10(sf)))
+	return append(r, uint16(u>>16), uint16(u))
+}
+
+// sunSpecInt scales a value into an int16, saturating at its bounds since
+// the minimum is reserved for values which aren't implemented.
+func sunSpecInt(v float64, sf int) uint16 {
+	v = math.Round(v / math.Pow10(sf))
+	v = math.Max(math.Min(v, math.MaxInt16), math.MinInt16+1)
+
+	return uint16(int16(v))
+}
+
+func sunSpecScale(sf int) uint16 {
+	return uint16(int16(sf))
+}
+
+func sunSpecNotImplemented(n int) []uint16 {
+	r := make([]uint16, n)
+	for i := range r {
+		r[i] = sunSpecNotImplemented16
+	}
+
+	return r
+}
+
+func modbusException(fc, code byte) []byte {
+	return []byte{fc | 0x80, code}
+}
+
+func NewModbusServer(l log.Logger, s *P1State, v string) *ModbusServer {
+	return &ModbusServer{
+		Logger:  l,
+		P1State: s,
+		Version: v,
+	}
+}
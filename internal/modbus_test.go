@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestModbusServerRegisters(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	// The meter's clock is recent, otherwise the registers aren't served.
+	err := s.handleTelegram(ParseTelegram(
+		"/KFM5KAIFA-METER\r\n" +
+			"\r\n" +
+			"1-3:0.2.8(50)\r\n" +
+			"0-0:1.0.0(" + time.Now().In(cest).Format("060102150405") + "S)\r\n" +
+			"0-0:96.1.1(4B464D303031)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n" +
+			"1-0:1.7.0(00.500*kW)\r\n" +
+			"1-0:21.7.0(00.500*kW)\r\n" +
+			"1-0:32.7.0(230.1*V)\r\n" +
+			"1-0:31.7.0(002*A)\r\n" +
+			"!1234\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	m := NewModbusServer(log.Base(), s, "1.0.0")
+
+	// Registers are read in chunks, as a client is limited to 125 at once.
+	var regs []uint16
+	for _, q := range [][2]int{{40000, 125}, {40125, 54}} {
+		pdu := []byte{modbusReadHoldingRegisters}
+		pdu = binary.BigEndian.AppendUint16(pdu, uint16(q[0]))
+		pdu = binary.BigEndian.AppendUint16(pdu, uint16(q[1]))
+
+		r := m.handle(pdu)
+		if len(r) != 2+2*q[1] || r[0] != modbusReadHoldingRegisters {
+			t.Fatalf("handle(%d, %d) = % x", q[0], q[1], r)
+		}
+
+		for i := 2; i < len(r); i += 2 {
+			regs = append(regs, binary.BigEndian.Uint16(r[i:]))
+		}
+	}
+
+	// Registers are relative to 40000, the meter model starts at 40072.
+	tests := []struct {
+		name  string
+		index int
+		want  uint16
+	}{
+		{"SunS marker", 0, 0x5375},
+		{"SunS marker", 1, 0x6e53},
+		{"common model", 2, 1},
+		{"common model length", 3, 66},
+		{"meter model", 70, 203},
+		{"meter model length", 71, 105},
+		{"current l1", 72 + 1, 200},
+		{"current scale factor", 72 + 4, 0xfffe},
+		{"voltage l1", 72 + 6, 2301},
+		{"voltage scale factor", 72 + 13, 0xffff},
+		{"power", 72 + 16, 500},
+		{"power l1", 72 + 17, 500},
+		{"power scale factor", 72 + 20, 0},
+		{"apparent power scale factor", 72 + 25, 0},
+		{"power factor scale factor", 72 + 35, 0xffff},
+		{"energy imported", 72 + 45, 123456 & 0xffff},
+		{"energy imported", 72 + 44, 123456 >> 16},
+		{"energy scale factor", 72 + 52, 0},
+		{"end marker", 177, 0xffff},
+		{"end marker length", 178, 0},
+	}
+
+	for _, tt := range tests {
+		if regs[tt.index] != tt.want {
+			t.Errorf("%s at %d = %#x, want %#x", tt.name, sunSpecBase+tt.index, regs[tt.index], tt.want)
+		}
+	}
+
+	// Nothing is served past the end marker.
+	pdu := []byte{modbusReadHoldingRegisters}
+	pdu = binary.BigEndian.AppendUint16(pdu, sunSpecBase+179)
+	pdu = binary.BigEndian.AppendUint16(pdu, 1)
+
+	if r := m.handle(pdu); len(r) != 2 || r[1] != modbusIllegalDataAddress {
+		t.Errorf("handle(%d, 1) = % x, want illegal data address", sunSpecBase+179, r)
+	}
+}
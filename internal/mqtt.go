@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	mqttAvailabilityInterval = 10 * time.Second
+	mqttTimeout              = 10 * time.Second
+	mqttOnline               = "online"
+	mqttOffline              = "offline"
+)
+
+var (
+	ErrInvalidMQTTFormat = errors.New("invalid MQTT format")
+	ErrInvalidMQTTQoS    = errors.New("invalid MQTT quality of service level")
+	ErrNoCertificates    = errors.New("no certificates found")
+)
+
+type MQTTFormat string
+
+const (
+	MQTTFormatFields MQTTFormat = "fields"
+	MQTTFormatJSON   MQTTFormat = "json"
+	MQTTFormatBoth   MQTTFormat = "both"
+)
+
+func ParseMQTTFormat(s string) (MQTTFormat, error) {
+	switch f := MQTTFormat(s); f {
+	case MQTTFormatFields, MQTTFormatJSON, MQTTFormatBoth:
+		return f, nil
+	default:
+		return "", ErrInvalidMQTTFormat
+	}
+}
+
+func ParseMQTTQoS(v uint) (byte, error) {
+	if v > 2 {
+		return 0, ErrInvalidMQTTQoS
+	}
+
+	return byte(v), nil
+}
+
+type MQTTConfig struct {
+	BrokerURL              string
+	ClientID               string
+	Username               string
+	Password               string
+	TLSCAFile              string
+	TLSCertFile            string
+	TLSKeyFile             string
+	TLSInsecureSkipVerify  bool
+	TopicPrefix            string
+	QoS                    byte
+	Retain                 bool
+	Format                 MQTTFormat
+	HomeAssistantDiscovery bool
+	HomeAssistantPrefix    string
+}
+
+// MQTTPublisher publishes every snapshot to an MQTT broker, along with an
+// availability topic which follows p1_up.
+type MQTTPublisher struct {
+	Logger      log.Logger
+	P1State     *P1State
+	TariffNames TariffNames
+	Config      MQTTConfig
+
+	client     mqtt.Client
+	mutex      sync.Mutex
+	online     bool
+	discovered map[string]struct{}
+}
+
+func (p *MQTTPublisher) Start() {
+	p.client.Connect()
+
+	c := p.P1State.Subscribe()
+	t := time.NewTicker(mqttAvailabilityInterval)
+
+	for {
+		select {
+		case s := <-c:
+			p.publishAvailability(s)
+			p.publishSnapshot(s)
+
+		case <-t.C:
+			p.publishAvailability(p.P1State.Snapshot())
+		}
+	}
+}
+
+func (p *MQTTPublisher) AvailabilityTopic() string {
+	return p.topic("status")
+}
+
+func (p *MQTTPublisher) topic(parts ...string) string {
+	return strings.Join(append([]string{p.Config.TopicPrefix}, parts...), "/")
+}
+
+func (p *MQTTPublisher) publish(topic string, retain bool, payload interface{}) {
+	if !p.client.IsConnectionOpen() {
+		return
+	}
+
+	p.wait(
+		p.client.Publish(topic, p.Config.QoS, retain, payload),
+		"failed to publish to "+topic,
+	)
+}
+
+// wait logs the error of an operation once it completes, without holding up
+// the caller while the broker acknowledges it.
+func (p *MQTTPublisher) wait(t mqtt.Token, msg string) {
+	go func() {
+		if !t.WaitTimeout(mqttTimeout) {
+			p.Logger.Errorln(msg+":", "timed out")
+			return
+		}
+
+		if err := t.Error(); err != nil {
+			p.Logger.Errorln(msg+":", err)
+		}
+	}()
+}
+
+func (p *MQTTPublisher) publishAvailability(s Snapshot) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if s.Up() == p.online {
+		return
+	}
+
+	p.online = s.Up()
+	p.publish(p.AvailabilityTopic(), true, p.availability())
+}
+
+func (p *MQTTPublisher) availability() string {
+	if p.online {
+		return mqttOnline
+	}
+
+	return mqttOffline
+}
+
+func (p *MQTTPublisher) publishSnapshot(s Snapshot) {
+	// Home Assistant's sensors are backed by the field topics, so these are
+	// published regardless of the format when discovery is enabled.
+	if p.Config.Format != MQTTFormatJSON || p.Config.HomeAssistantDiscovery {
+		fs := s.Fields(p.TariffNames)
+		if p.Config.HomeAssistantDiscovery {
+			p.publishDiscovery(s, fs)
+		}
+
+		for _, f := range fs {
+			p.publish(p.fieldTopic(f), p.Config.Retain, f.String())
+		}
+	}
+
+	if p.Config.Format != MQTTFormatFields {
+		b, err := json.Marshal(newSnapshotResponse(s, p.TariffNames))
+		if err != nil {
+			p.Logger.Errorln(err)
+			return
+		}
+
+		p.publish(p.topic("snapshot"), p.Config.Retain, b)
+	}
+}
+
+func (p *MQTTPublisher) fieldTopic(f Field) string {
+	t := []string{f.Subsystem, f.Name}
+	if f.Tariff != "" {
+		t = append(t, f.Tariff)
+	}
+
+	if f.Phase != "" {
+		t = append(t, f.Phase)
+	}
+
+	return p.topic(t...)
+}
+
+func (p *MQTTPublisher) onConnect(c mqtt.Client) {
+	p.Logger.Infoln("connected to MQTT broker", p.Config.BrokerURL)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Announce availability again, the broker may have published the last
+	// will while the connection was lost.
+	p.wait(
+		c.Publish(p.AvailabilityTopic(), p.Config.QoS, true, p.availability()),
+		"failed to publish to "+p.AvailabilityTopic(),
+	)
+
+	if p.Config.HomeAssistantDiscovery {
+		p.discovered = nil
+		p.wait(
+			c.Subscribe(
+				p.Config.HomeAssistantPrefix+"/status",
+				p.Config.QoS,
+				p.onHomeAssistantStatus,
+			),
+			"failed to subscribe to "+p.Config.HomeAssistantPrefix+"/status",
+		)
+	}
+}
+
+func (p *MQTTPublisher) onConnectionLost(_ mqtt.Client, err error) {
+	p.Logger.Errorln("lost connection to MQTT broker:", err)
+}
+
+func NewMQTTPublisher(
+	l log.Logger,
+	s *P1State,
+	n TariffNames,
+	c MQTTConfig,
+) (*MQTTPublisher, error) {
+	p := &MQTTPublisher{
+		Logger:      l,
+		P1State:     s,
+		TariffNames: n,
+		Config:      c,
+	}
+
+	t, err := newMQTTTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	o := mqtt.NewClientOptions().
+		AddBroker(c.BrokerURL).
+		SetClientID(c.ClientID).
+		SetUsername(c.Username).
+		SetPassword(c.Password).
+		SetTLSConfig(t).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(p.AvailabilityTopic(), mqttOffline, c.QoS, true).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(p.onConnectionLost)
+
+	p.client = mqtt.NewClient(o)
+	return p, nil
+}
+
+func newMQTTTLSConfig(c MQTTConfig) (*tls.Config, error) {
+	t := &tls.Config{
+		InsecureSkipVerify: c.TLSInsecureSkipVerify, // #nosec G402 -- opt-in
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if c.TLSCAFile != "" {
+		b, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(b) {
+			return nil, ErrNoCertificates
+		}
+	}
+
+	if c.TLSCertFile != "" {
+		v, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		t.Certificates = []tls.Certificate{v}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,396 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// testBroker is a minimal MQTT 3.1.1 broker, which keeps the retained
+// messages and publishes the last will when a connection is dropped.
+type testBroker struct {
+	listener net.Listener
+
+	mutex         sync.Mutex
+	conns         []net.Conn
+	retained      map[string]string
+	history       map[string][]string
+	subscriptions []string
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &testBroker{
+		listener: l,
+		retained: make(map[string]string),
+		history:  make(map[string][]string),
+	}
+
+	go b.accept()
+	t.Cleanup(func() {
+		l.Close()
+		b.drop()
+	})
+
+	return b
+}
+
+func (b *testBroker) URL() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) accept() {
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.mutex.Lock()
+		b.conns = append(b.conns, c)
+		b.mutex.Unlock()
+
+		go b.serve(c)
+	}
+}
+
+// drop closes every connection without a DISCONNECT packet, as if the
+// network failed.
+func (b *testBroker) drop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, c := range b.conns {
+		c.Close()
+	}
+
+	b.conns = nil
+}
+
+func (b *testBroker) serve(c net.Conn) {
+	var (
+		r    = bufio.NewReader(c)
+		will *[2]string
+	)
+
+	defer func() {
+		c.Close()
+		if will != nil {
+			b.publish(will[0], will[1], true)
+		}
+	}()
+
+	for {
+		h, body, err := readTestPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch h >> 4 {
+		case 1: // CONNECT
+			will = parseTestConnect(body)
+			err = writeTestPacket(c, 0x20, []byte{0, 0})
+
+		case 3: // PUBLISH
+			topic, rest := readTestString(body)
+			switch h >> 1 & 3 {
+			case 0:
+				b.publish(topic, string(rest), h&1 == 1)
+			case 1:
+				b.publish(topic, string(rest[2:]), h&1 == 1)
+				err = writeTestPacket(c, 0x40, rest[:2])
+			case 2:
+				b.publish(topic, string(rest[2:]), h&1 == 1)
+				err = writeTestPacket(c, 0x50, rest[:2])
+			}
+
+		case 6: // PUBREL
+			err = writeTestPacket(c, 0x70, body[:2])
+
+		case 8: // SUBSCRIBE
+			ack := body[:2]
+			for rest := body[2:]; len(rest) > 0; rest = rest[1:] {
+				var f string
+				f, rest = readTestString(rest)
+				ack = append(ack, 0)
+
+				b.mutex.Lock()
+				b.subscriptions = append(b.subscriptions, f)
+				b.mutex.Unlock()
+			}
+
+			err = writeTestPacket(c, 0x90, ack)
+
+		case 12: // PINGREQ
+			err = writeTestPacket(c, 0xd0, nil)
+
+		case 14: // DISCONNECT
+			will = nil
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *testBroker) publish(topic, payload string, retain bool) {
+	if !retain {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.retained[topic] = payload
+	b.history[topic] = append(b.history[topic], payload)
+}
+
+func (b *testBroker) Retained(topic string) (string, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	v, ok := b.retained[topic]
+	return v, ok
+}
+
+// History returns every retained message published to topic.
+func (b *testBroker) History(topic string) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]string(nil), b.history[topic]...)
+}
+
+func (b *testBroker) Subscriptions() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]string(nil), b.subscriptions...)
+}
+
+func (b *testBroker) waitRetained(t *testing.T, topic, want string) {
+	t.Helper()
+
+	for d := time.Now().Add(5 * time.Second); time.Now().Before(d); {
+		if v, _ := b.Retained(topic); v == want {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	v, _ := b.Retained(topic)
+	t.Fatalf("retained %s = %q, want %q", topic, v, want)
+}
+
+func readTestPacket(r *bufio.Reader) (byte, []byte, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var n, s int
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		n |= int(c&0x7f) << s
+		if c&0x80 == 0 {
+			break
+		}
+
+		if s += 7; s > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return h, b, err
+}
+
+func writeTestPacket(w io.Writer, h byte, body []byte) error {
+	b := []byte{h}
+	for n := len(body); ; {
+		c := byte(n & 0x7f)
+		if n >>= 7; n > 0 {
+			c |= 0x80
+		}
+
+		b = append(b, c)
+		if n == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(b, body...))
+	return err
+}
+
+func readTestString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func parseTestConnect(b []byte) *[2]string {
+	_, b = readTestString(b) // protocol name
+	flags := b[1]
+	_, b = readTestString(b[4:]) // client identifier
+
+	if flags&0x04 == 0 {
+		return nil
+	}
+
+	var w [2]string
+	w[0], b = readTestString(b)
+	w[1], _ = readTestString(b)
+
+	if flags&0x20 == 0 {
+		return nil
+	}
+
+	return &w
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	b := newTestBroker(t)
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	// The meter's clock is recent, otherwise the snapshot isn't up.
+	err := s.handleTelegram(ParseTelegram(
+		"/KFM5KAIFA-METER\r\n" +
+			"\r\n" +
+			"1-3:0.2.8(42)\r\n" +
+			"0-0:1.0.0(" + time.Now().In(cest).Format("060102150405") + "S)\r\n" +
+			"0-0:96.1.1(4B464D303031)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n" +
+			"1-0:1.7.0(00.500*kW)\r\n" +
+			"!1234\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	p, err := NewMQTTPublisher(
+		log.Base(),
+		s,
+		nil,
+		MQTTConfig{
+			BrokerURL:              b.URL(),
+			ClientID:               "p1_exporter",
+			TopicPrefix:            "p1",
+			QoS:                    1,
+			Retain:                 true,
+			Format:                 MQTTFormatBoth,
+			HomeAssistantDiscovery: true,
+			HomeAssistantPrefix:    "homeassistant",
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("NewMQTTPublisher() error = %v", err)
+	}
+
+	if tk := p.client.Connect(); !tk.WaitTimeout(5*time.Second) || tk.Error() != nil {
+		t.Fatalf("Connect() error = %v", tk.Error())
+	}
+
+	t.Cleanup(func() {
+		p.client.Disconnect(0)
+	})
+
+	// Not up until the first snapshot has been published.
+	b.waitRetained(t, "p1/status", mqttOffline)
+
+	v := s.Snapshot()
+	p.publishAvailability(v)
+	p.publishSnapshot(v)
+
+	b.waitRetained(t, "p1/status", mqttOnline)
+	b.waitRetained(t, "p1/electricity/delivered/1", "123456")
+	b.waitRetained(t, "p1/electricity/power_delivered", "500")
+
+	if v := b.Subscriptions(); len(v) != 1 || v[0] != "homeassistant/status" {
+		t.Errorf("subscriptions = %v, want [homeassistant/status]", v)
+	}
+
+	t.Run("snapshot", func(t *testing.T) {
+		m, _ := b.Retained("p1/snapshot")
+
+		var r snapshotResponse
+		if err := json.Unmarshal([]byte(m), &r); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		if !r.Up {
+			t.Errorf("Up = false, want true")
+		}
+
+		if r.Meter.EquipmentIdentifier != "KFM001" {
+			t.Errorf("EquipmentIdentifier = %q, want %q", r.Meter.EquipmentIdentifier, "KFM001")
+		}
+	})
+
+	t.Run("discovery", func(t *testing.T) {
+		m, ok := b.Retained("homeassistant/sensor/p1_kfm001/electricity_delivered_1/config")
+		if !ok {
+			t.Fatal("discovery config not retained")
+		}
+
+		var c homeAssistantSensor
+		if err := json.Unmarshal([]byte(m), &c); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		want := homeAssistantSensor{
+			Name:              "Delivered 1",
+			UniqueID:          "p1_kfm001_electricity_delivered_1",
+			ObjectID:          "p1_kfm001_electricity_delivered_1",
+			StateTopic:        "p1/electricity/delivered/1",
+			AvailabilityTopic: "p1/status",
+			DeviceClass:       "energy",
+			StateClass:        "total_increasing",
+			Unit:              "Wh",
+		}
+
+		c.Device = homeAssistantDevice{}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("config = %+v, want %+v", c, want)
+		}
+	})
+
+	t.Run("will", func(t *testing.T) {
+		n := len(b.History("p1/status"))
+		b.drop()
+
+		// Availability is announced again once reconnected.
+		want := []string{mqttOffline, mqttOnline}
+		for d := time.Now().Add(5 * time.Second); time.Now().Before(d); {
+			if reflect.DeepEqual(b.History("p1/status")[n:], want) {
+				return
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		t.Errorf("status = %v, want %v", b.History("p1/status")[n:], want)
+	})
+}
@@ -0,0 +1,405 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	otlpScope           = "github.com/pmaene/p1_exporter"
+	otlpShutdownTimeout = 10 * time.Second
+)
+
+var ErrInvalidOTLPProtocol = errors.New("invalid OTLP protocol")
+
+type OTLPProtocol string
+
+const (
+	OTLPProtocolHTTP OTLPProtocol = "http"
+	OTLPProtocolGRPC OTLPProtocol = "grpc"
+)
+
+func ParseOTLPProtocol(s string) (OTLPProtocol, error) {
+	switch p := OTLPProtocol(s); p {
+	case OTLPProtocolHTTP, OTLPProtocolGRPC:
+		return p, nil
+	default:
+		return "", ErrInvalidOTLPProtocol
+	}
+}
+
+type OTLPConfig struct {
+	Endpoint string
+	Protocol OTLPProtocol
+	Headers  map[string]string
+	Interval time.Duration
+	Version  string
+}
+
+type otlpInstruments struct {
+	up                        metric.Float64ObservableGauge
+	restored                  metric.Float64ObservableGauge
+	electricPowerDelivered    metric.Float64ObservableGauge
+	totalElectricityDelivered metric.Float64ObservableCounter
+	electricPowerInjected     metric.Float64ObservableGauge
+	totalElectricityInjected  metric.Float64ObservableCounter
+	electricPowerNet          metric.Float64ObservableGauge
+	totalElectricityNet       metric.Float64ObservableGauge
+	apparentPower             metric.Float64ObservableGauge
+	electricityDemand         metric.Float64ObservableGauge
+	electricityDemandPeak     metric.Float64ObservableGauge
+	electricCurrent           metric.Float64ObservableGauge
+	voltage                   metric.Float64ObservableGauge
+	electricityTariffActive   metric.Float64ObservableGauge
+	breakerState              metric.Float64ObservableGauge
+	limiterThreshold          metric.Float64ObservableGauge
+	fuseThreshold             metric.Float64ObservableGauge
+	electricityCost           metric.Float64ObservableCounter
+	electricityRevenue        metric.Float64ObservableCounter
+	totalGasDelivered         metric.Float64ObservableCounter
+	gasCost                   metric.Float64ObservableCounter
+	gasFlowRate               metric.Float64ObservableGauge
+	gasValveState             metric.Float64ObservableGauge
+}
+
+// OTLPExporter exports the collector's quantities as OpenTelemetry metrics.
+// The meter's identity is part of the resource, so the exporter only starts
+// once the first telegram has been received.
+type OTLPExporter struct {
+	Logger      log.Logger
+	P1State     *P1State
+	TariffNames TariffNames
+	Config      OTLPConfig
+
+	instruments otlpInstruments
+	reader      sdkmetric.Reader
+	mutex       sync.Mutex
+	provider    *sdkmetric.MeterProvider
+}
+
+func (e *OTLPExporter) Start() {
+	s := e.waitForSnapshot()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.provider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(e.reader),
+		sdkmetric.WithResource(e.newResource(s)),
+	)
+
+	m := e.provider.Meter(otlpScope, metric.WithInstrumentationVersion(e.Config.Version))
+	if err := e.register(m); err != nil {
+		e.Logger.Errorln("unable to register OTLP instruments:", err)
+	}
+}
+
+// Shutdown exports the last observations and stops the exporter.
+func (e *OTLPExporter) Shutdown() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+	defer cancel()
+
+	// The reader is only handed to a provider once the meter is known.
+	var err error
+	if e.provider != nil {
+		err = e.provider.Shutdown(ctx)
+	} else {
+		err = e.reader.Shutdown(ctx)
+	}
+
+	if err != nil {
+		e.Logger.Errorln("unable to shut down OTLP exporter:", err)
+	}
+}
+
+func (e *OTLPExporter) waitForSnapshot() Snapshot {
+	c := e.P1State.Subscribe()
+	defer e.P1State.Unsubscribe(c)
+
+	s := e.P1State.Snapshot()
+	for s.EquipmentIdentifier == "" {
+		s = <-c
+	}
+
+	return s
+}
+
+func (e *OTLPExporter) newReader() (sdkmetric.Reader, error) {
+	var (
+		exp sdkmetric.Exporter
+		err error
+	)
+
+	switch e.Config.Protocol {
+	case OTLPProtocolGRPC:
+		exp, err = otlpmetricgrpc.New(
+			context.Background(),
+			otlpmetricgrpc.WithEndpointURL(e.Config.Endpoint),
+			otlpmetricgrpc.WithHeaders(e.Config.Headers),
+		)
+
+	default:
+		exp, err = otlpmetrichttp.New(
+			context.Background(),
+			otlpmetrichttp.WithEndpointURL(e.Config.Endpoint),
+			otlpmetrichttp.WithHeaders(e.Config.Headers),
+		)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sdkmetric.NewPeriodicReader(
+		exp,
+		sdkmetric.WithInterval(e.Config.Interval),
+	), nil
+}
+
+func (e *OTLPExporter) newResource(s Snapshot) *resource.Resource {
+	a := []attribute.KeyValue{
+		attribute.String("service.name", "p1_exporter"),
+		attribute.String("service.version", e.Config.Version),
+		attribute.String("p1.meter.equipment_id", s.EquipmentIdentifier),
+		attribute.String("p1.meter.dsmr_version", s.Version.String()),
+		attribute.String("p1.meter.manufacturer", s.Header.Manufacturer.Name),
+		attribute.String("p1.meter.model", s.Header.Model),
+	}
+
+	if s.GasEquipmentIdentifier != "" {
+		a = append(a, attribute.String("p1.meter.gas_equipment_id", s.GasEquipmentIdentifier))
+	}
+
+	return resource.NewSchemaless(a...)
+}
+
+func (e *OTLPExporter) register(m metric.Meter) error {
+	var (
+		i   = &e.instruments
+		err error
+	)
+
+	gauge := func(g *metric.Float64ObservableGauge, name, unit, desc string) {
+		if err == nil {
+			*g, err = m.Float64ObservableGauge(
+				name,
+				metric.WithUnit(unit),
+				metric.WithDescription(desc),
+			)
+		}
+	}
+
+	counter := func(c *metric.Float64ObservableCounter, name, unit, desc string) {
+		if err == nil {
+			*c, err = m.Float64ObservableCounter(
+				name,
+				metric.WithUnit(unit),
+				metric.WithDescription(desc),
+			)
+		}
+	}
+
+	var currency string
+	if c := e.P1State.Snapshot().Currency; c != "" {
+		currency = "{" + c + "}"
+	}
+
+	gauge(&i.up, "p1.up", "1", "Whether the smart meter is up.")
+	gauge(&i.restored, "p1.restored", "1", "Whether the values were restored from storage.")
+	gauge(&i.electricPowerDelivered, "p1.electricity.power_delivered", "W", "Power delivered to the client.")
+	counter(&i.totalElectricityDelivered, "p1.electricity.delivered", "Wh", "Energy delivered to the client.")
+	gauge(&i.electricPowerInjected, "p1.electricity.power_injected", "W", "Power injected by the client.")
+	counter(&i.totalElectricityInjected, "p1.electricity.injected", "Wh", "Energy injected by the client.")
+	gauge(&i.electricPowerNet, "p1.electricity.power_net", "W", "Power delivered minus power injected.")
+	gauge(&i.totalElectricityNet, "p1.electricity.net", "Wh", "Energy delivered minus energy injected.")
+	gauge(&i.apparentPower, "p1.electricity.power_apparent", "VA", "Apparent power per phase.")
+	gauge(&i.electricityDemand, "p1.electricity.demand", "W", "Average power of the current quarter-hour.")
+	gauge(&i.electricityDemandPeak, "p1.electricity.demand_peak", "W", "Highest quarter-hour average power this month.")
+	gauge(&i.electricCurrent, "p1.electricity.current", "A", "Current per phase.")
+	gauge(&i.voltage, "p1.electricity.voltage", "V", "Voltage per phase.")
+	gauge(&i.electricityTariffActive, "p1.electricity.tariff_active", "1", "Whether the tariff is active.")
+	gauge(&i.breakerState, "p1.electricity.breaker_state", "1", "State of the breaker.")
+	gauge(&i.limiterThreshold, "p1.electricity.limiter_threshold", "W", "Threshold of the power limiter.")
+	gauge(&i.fuseThreshold, "p1.electricity.fuse_threshold", "A", "Fuse supervision threshold per phase.")
+	counter(&i.electricityCost, "p1.electricity.cost", currency, "Amount paid for electricity.")
+	counter(&i.electricityRevenue, "p1.electricity.revenue", currency, "Amount received for electricity.")
+	counter(&i.totalGasDelivered, "p1.gas.delivered", "m3", "Gas delivered to the client.")
+	counter(&i.gasCost, "p1.gas.cost", currency, "Cost of the gas delivered.")
+	gauge(&i.gasFlowRate, "p1.gas.flow", "m3/h", "Gas flow rate derived from consecutive readings.")
+	gauge(&i.gasValveState, "p1.gas.valve_state", "1", "State of the gas valve.")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = m.RegisterCallback(
+		e.observe,
+		i.up,
+		i.restored,
+		i.electricPowerDelivered,
+		i.totalElectricityDelivered,
+		i.electricPowerInjected,
+		i.totalElectricityInjected,
+		i.electricPowerNet,
+		i.totalElectricityNet,
+		i.apparentPower,
+		i.electricityDemand,
+		i.electricityDemandPeak,
+		i.electricCurrent,
+		i.voltage,
+		i.electricityTariffActive,
+		i.breakerState,
+		i.limiterThreshold,
+		i.fuseThreshold,
+		i.electricityCost,
+		i.electricityRevenue,
+		i.totalGasDelivered,
+		i.gasCost,
+		i.gasFlowRate,
+		i.gasValveState,
+	)
+
+	return err
+}
+
+func (e *OTLPExporter) observe(_ context.Context, o metric.Observer) error {
+	var (
+		i = &e.instruments
+		s = e.P1State.Snapshot()
+	)
+
+	tariff := func(k int) metric.ObserveOption {
+		return metric.WithAttributes(attribute.String("tariff", e.TariffNames.Name(k)))
+	}
+
+	phase := func(k string) metric.ObserveOption {
+		return metric.WithAttributes(attribute.String("phase", k))
+	}
+
+	state := func(k string) metric.ObserveOption {
+		return metric.WithAttributes(attribute.String("state", k))
+	}
+
+	o.ObserveFloat64(i.up, boolFloat(s.Up()))
+	if s.Timestamp.IsZero() {
+		return nil
+	}
+
+	o.ObserveFloat64(i.restored, boolFloat(s.Restored))
+	o.ObserveFloat64(i.electricPowerDelivered, float64(s.ElectricPowerDelivered))
+	o.ObserveFloat64(i.electricPowerInjected, float64(s.ElectricPowerInjected))
+	o.ObserveFloat64(i.electricPowerNet, float64(s.ElectricPowerNet()))
+	o.ObserveFloat64(i.totalElectricityNet, float64(s.TotalElectricityNet()))
+	o.ObserveFloat64(i.electricityDemand, float64(s.ElectricityDemand))
+	o.ObserveFloat64(i.limiterThreshold, float64(s.ElectricityLimiterThreshold))
+
+	if !s.ElectricityDemandPeakTime.IsZero() {
+		o.ObserveFloat64(i.electricityDemandPeak, float64(s.ElectricityDemandPeak))
+	}
+
+	for k, v := range s.TotalElectricityDelivered {
+		o.ObserveFloat64(i.totalElectricityDelivered, float64(v), tariff(k))
+	}
+
+	for k, v := range s.TotalElectricityInjected {
+		o.ObserveFloat64(i.totalElectricityInjected, float64(v), tariff(k))
+	}
+
+	for k, v := range s.ApparentPower() {
+		o.ObserveFloat64(i.apparentPower, float64(v), phase(k))
+	}
+
+	for k, v := range s.ElectricCurrent {
+		o.ObserveFloat64(i.electricCurrent, float64(v), phase(k))
+	}
+
+	for k, v := range s.Voltage {
+		o.ObserveFloat64(i.voltage, float64(v), phase(k))
+	}
+
+	for k, v := range s.FuseThreshold {
+		o.ObserveFloat64(i.fuseThreshold, float64(v), phase(k))
+	}
+
+	for _, k := range tariffs(e.TariffNames, s) {
+		o.ObserveFloat64(i.electricityTariffActive, boolFloat(k == s.ElectricityTariffIndicator), tariff(k))
+	}
+
+	if s.BreakerStateObserved {
+		for _, k := range BreakerStates {
+			o.ObserveFloat64(i.breakerState, boolFloat(k == s.BreakerState), state(k.String()))
+		}
+	}
+
+	if s.Currency != "" {
+		for k, v := range s.ElectricityCost {
+			o.ObserveFloat64(i.electricityCost, v, tariff(k))
+		}
+
+		for k, v := range s.ElectricityRevenue {
+			o.ObserveFloat64(i.electricityRevenue, v, tariff(k))
+		}
+	}
+
+	if s.GasEquipmentIdentifier == "" {
+		return nil
+	}
+
+	o.ObserveFloat64(i.totalGasDelivered, float64(s.TotalGasDelivered))
+	o.ObserveFloat64(i.gasFlowRate, float64(s.GasFlowRate))
+
+	if s.Currency != "" {
+		o.ObserveFloat64(i.gasCost, s.GasCost)
+	}
+
+	if s.GasValveStateObserved {
+		for _, k := range GasValveStates {
+			o.ObserveFloat64(i.gasValveState, boolFloat(k == s.GasValveState), state(k.String()))
+		}
+	}
+
+	return nil
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func NewOTLPExporter(
+	l log.Logger,
+	s *P1State,
+	n TariffNames,
+	c OTLPConfig,
+) (*OTLPExporter, error) {
+	e := &OTLPExporter{
+		Logger:      l,
+		P1State:     s,
+		TariffNames: n,
+		Config:      c,
+	}
+
+	r, err := e.newReader()
+	if err != nil {
+		return nil, err
+	}
+
+	e.reader = r
+	return e, nil
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestOTLPExporterShutdown(t *testing.T) {
+	for _, p := range []OTLPProtocol{OTLPProtocolHTTP, OTLPProtocolGRPC} {
+		e, err := NewOTLPExporter(
+			log.Base(),
+			NewP1State(log.Base(), nil, nil, nil),
+			nil,
+			OTLPConfig{
+				Endpoint: "http://127.0.0.1:4318",
+				Protocol: p,
+				Interval: time.Minute,
+			},
+		)
+
+		if err != nil {
+			t.Fatalf("NewOTLPExporter(%s) error = %v", p, err)
+		}
+
+		// Nothing was exported yet, so this doesn't connect.
+		e.Shutdown()
+	}
+}
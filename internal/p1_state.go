@@ -1,7 +1,8 @@
 package internal
 
 import (
-	"strconv"
+	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -10,28 +11,51 @@ import (
 )
 
 type P1State struct {
-	Logger log.Logger
-	P1     *gop1.P1
+	Logger  log.Logger
+	P1      *Reader
+	Storage *Storage
+	Prices  *Prices
 
 	mutex                       sync.RWMutex
 	timestamp                   time.Time
+	receivedTimestamp           time.Time
+	telegram                    *Telegram
+	telegramError               error
 	timestampDifference         time.Duration
-	version                     int
+	meterTimestamp              time.Time
+	version                     DSMRVersion
+	header                      TelegramHeader
 	equipmentIdentifier         string
 	gasEquipmentIdentifier      string
+	rawEquipmentIdentifier      string
+	rawGasEquipmentIdentifier   string
 	electricPowerDelivered      Power
 	totalElectricityDelivered   map[int]Energy
 	electricPowerInjected       Power
 	totalElectricityInjected    map[int]Energy
+	phasePowerDelivered         map[string]Power
+	phasePowerInjected          map[string]Power
 	electricCurrent             map[string]ElectricCurrent
 	voltage                     map[string]Voltage
 	electricityTariffIndicator  int
 	breakerState                BreakerState
+	breakerStateObserved        bool
 	electricityLimiterThreshold Power
 	fuseThreshold               map[string]ElectricCurrent
 	totalGasDeliveredTimestamp  time.Time
 	totalGasDelivered           Volume
+	gasFlowMeter                flowMeter
 	gasValveState               GasValveState
+	gasValveStateObserved       bool
+	stateChanges                []StateChange
+	demand                      demandTracker
+	cost                        costTracker
+	periods                     periodTracker
+	restored                    bool
+	checkpointRequests          chan struct{}
+	snapshots                   Broadcaster[Snapshot]
+	telegrams                   Broadcaster[*Telegram]
+	recentErrors                errorLog
 }
 
 func (s *P1State) Timestamp() time.Time {
@@ -41,13 +65,27 @@ func (s *P1State) Timestamp() time.Time {
 	return s.timestamp
 }
 
-func (s *P1State) Version() int {
+func (s *P1State) Version() DSMRVersion {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	return s.version
 }
 
+func (s *P1State) Manufacturer() Manufacturer {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.header.Manufacturer
+}
+
+func (s *P1State) Model() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.header.Model
+}
+
 func (s *P1State) EquipmentIndentifier() string {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -90,6 +128,20 @@ func (s *P1State) TotalElectricityInjected() map[int]Energy {
 	return s.totalElectricityInjected
 }
 
+func (s *P1State) PhasePowerDelivered() map[string]Power {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.phasePowerDelivered
+}
+
+func (s *P1State) PhasePowerInjected() map[string]Power {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.phasePowerInjected
+}
+
 func (s *P1State) ElectricCurrent() map[string]ElectricCurrent {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -146,6 +198,13 @@ func (s *P1State) TotalGasDelivered() Volume {
 	return s.totalGasDelivered
 }
 
+func (s *P1State) GasFlowRate() VolumeFlowRate {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.gasFlowMeter.Rate()
+}
+
 func (s *P1State) GasValveState() GasValveState {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -153,219 +212,566 @@ func (s *P1State) GasValveState() GasValveState {
 	return s.gasValveState
 }
 
+func (s *P1State) ElectricityDemand() Power {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.demand.Average()
+}
+
+func (s *P1State) ElectricityDemandPeak() (Power, time.Time) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.demand.Peak()
+}
+
+func (s *P1State) Snapshot() Snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.snapshot()
+}
+
+func (s *P1State) snapshot() Snapshot {
+	p, t := s.demand.Peak()
+	v := Snapshot{
+		Timestamp:                   s.timestamp,
+		MeterTimestamp:              s.meterTimestamp,
+		ReceivedTimestamp:           s.receivedTimestamp,
+		Version:                     s.version,
+		Header:                      s.header,
+		EquipmentIdentifier:         s.equipmentIdentifier,
+		GasEquipmentIdentifier:      s.gasEquipmentIdentifier,
+		RawEquipmentIdentifier:      s.rawEquipmentIdentifier,
+		RawGasEquipmentIdentifier:   s.rawGasEquipmentIdentifier,
+		ElectricPowerDelivered:      s.electricPowerDelivered,
+		TotalElectricityDelivered:   copyMap(s.totalElectricityDelivered),
+		ElectricPowerInjected:       s.electricPowerInjected,
+		TotalElectricityInjected:    copyMap(s.totalElectricityInjected),
+		PhasePowerDelivered:         copyMap(s.phasePowerDelivered),
+		PhasePowerInjected:          copyMap(s.phasePowerInjected),
+		ElectricCurrent:             copyMap(s.electricCurrent),
+		Voltage:                     copyMap(s.voltage),
+		ElectricityTariffIndicator:  s.electricityTariffIndicator,
+		BreakerState:                s.breakerState,
+		BreakerStateObserved:        s.breakerStateObserved,
+		ElectricityLimiterThreshold: s.electricityLimiterThreshold,
+		FuseThreshold:               copyMap(s.fuseThreshold),
+		TotalGasDeliveredTimestamp:  s.totalGasDeliveredTimestamp,
+		TotalGasDelivered:           s.totalGasDelivered,
+		GasFlowRate:                 s.gasFlowMeter.Rate(),
+		GasValveState:               s.gasValveState,
+		GasValveStateObserved:       s.gasValveStateObserved,
+		StateChanges:                slices.Clone(s.stateChanges),
+		ElectricityDemand:           s.demand.Average(),
+		ElectricityDemandPeak:       p,
+		ElectricityDemandPeakTime:   t,
+		Periods:                     s.periods.Totals(),
+		Restored:                    s.restored,
+	}
+
+	if s.Prices != nil {
+		v.Currency = s.Prices.Currency
+		v.ElectricityCost = copyMap(s.cost.ElectricityCost)
+		v.ElectricityRevenue = copyMap(s.cost.ElectricityRevenue)
+		v.GasCost = s.cost.GasCost
+	}
+
+	return v
+}
+
+// Subscribe returns a channel on which a snapshot is sent for every telegram
+// that was handled successfully.
+func (s *P1State) Subscribe() <-chan Snapshot {
+	return s.snapshots.Subscribe()
+}
+
+func (s *P1State) Unsubscribe(c <-chan Snapshot) {
+	s.snapshots.Unsubscribe(c)
+}
+
+// SubscribeTelegrams returns a channel on which every telegram read from the
+// meter is sent, including the ones which couldn't be handled.
+func (s *P1State) SubscribeTelegrams() <-chan *Telegram {
+	return s.telegrams.Subscribe()
+}
+
+func (s *P1State) UnsubscribeTelegrams(c <-chan *Telegram) {
+	s.telegrams.Unsubscribe(c)
+}
+
 func (s *P1State) Start() {
+	if s.Storage != nil {
+		if err := s.restore(); err != nil {
+			s.recordError(err)
+		}
+
+		go s.checkpoints()
+	}
+
 	s.P1.Start()
-	for {
-		if err := s.handleTelegram(<-s.P1.Incoming); err != nil {
-			s.Logger.Errorln(err)
+	for t := range s.P1.Incoming {
+		s.telegrams.Publish(t)
+		if err := s.handleTelegram(t); err != nil {
+			s.recordError(err)
 		}
 	}
 }
 
-func (s *P1State) handleTelegram(t *gop1.Telegram) error {
+// Errors returns the most recent errors, oldest first.
+func (s *P1State) Errors() []ErrorRecord {
+	return s.recentErrors.Records()
+}
+
+func (s *P1State) recordError(err error) {
+	s.Logger.Errorln(err)
+	s.recentErrors.Record(err)
+}
+
+func (s *P1State) Telegram() *Telegram {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.telegram
+}
+
+// TelegramError returns the error the most recent telegram was rejected with,
+// if any.
+func (s *P1State) TelegramError() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.telegramError
+}
+
+func (s *P1State) handleTelegram(t *Telegram) (err error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for _, o := range t.Objects {
-		switch o.Type {
-		case gop1.OBISTypeVersionInformation:
-			v, err := strconv.Atoi(o.Values[0].Value)
-			if err != nil {
-				return err
+	defer func() {
+		s.telegramError = err
+	}()
+
+	previous := s.telegram
+	s.telegram = t
+	s.stateChanges = nil
+
+	// The header only identifies the meter, an invalid one doesn't make the
+	// readings any less valid.
+	if t.Device != "" {
+		v, err := ParseTelegramHeader(t.Device)
+		if err != nil {
+			if previous == nil || previous.Device != t.Device {
+				s.Logger.Warnf("ignoring telegram header %q: %v", t.Device, err)
 			}
+		} else {
+			s.header = v
+		}
+	}
 
-			s.version = v
+	for i := range t.Lines {
+		l := &t.Lines[i]
+		if l.Object == nil {
+			continue
+		}
 
-		case gop1.OBISTypeDateTimestamp:
-			v, err := ParseTimestamp(o.Values[0])
-			if err != nil {
-				return err
-			}
+		l.Interpretation, l.Error = s.handleObject(l.Object)
+		if l.Error != nil {
+			return l.Error
+		}
+	}
 
-			d := time.Since(v)
-			if s.timestampDifference > 0 {
-				s.timestampDifference = (s.timestampDifference + d) / 2
-			} else {
-				s.timestampDifference = d
-			}
+	s.updateDemand()
+	s.updateCost()
+	s.updatePeriods()
+	s.receivedTimestamp = time.Now()
+	s.restored = false
 
-			s.timestamp = v.Add(s.timestampDifference)
+	s.snapshots.Publish(s.snapshot())
+	return nil
+}
 
-		case gop1.OBISTypeEquipmentIdentifier:
-			s.equipmentIdentifier = o.Values[0].Value
+// handleObject updates the state with an object of a telegram, returning how
+// it was interpreted. Objects which aren't used are ignored.
+func (s *P1State) handleObject(o *gop1.TelegramObject) (string, error) {
+	switch o.Type {
+	case gop1.OBISTypeVersionInformation:
+		v, err := ParseDSMRVersion(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-		case gop1.OBISTypeGasEquipmentIdentifier:
-			s.gasEquipmentIdentifier = o.Values[0].Value
+		s.version = v
+		return interpretValue("DSMR version", v), nil
 
-		case gop1.OBISTypeElectricityDeliveredTariff1:
-			v, err := ParseEnergy(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeDateTimestamp:
+		v, err := ParseTimestamp(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.totalElectricityDelivered[1] = v
+		s.meterTimestamp = v
 
-		case gop1.OBISTypeElectricityDeliveredTariff2:
-			v, err := ParseEnergy(o.Values[0])
-			if err != nil {
-				return err
-			}
+		d := time.Since(v)
+		if s.timestampDifference > 0 {
+			s.timestampDifference = (s.timestampDifference + d) / 2
+		} else {
+			s.timestampDifference = d
+		}
 
-			s.totalElectricityDelivered[2] = v
+		s.timestamp = v.Add(s.timestampDifference)
+		return interpretValue("meter timestamp", v), nil
 
-		case gop1.OBISTypeElectricityGeneratedTariff1:
-			v, err := ParseEnergy(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeEquipmentIdentifier:
+		s.equipmentIdentifier = ParseEquipmentIdentifier(o.Values[0])
+		s.rawEquipmentIdentifier = o.Values[0].Value
+		return interpretValue("equipment identifier", s.equipmentIdentifier), nil
 
-			s.totalElectricityInjected[1] = v
+	case gop1.OBISTypeGasEquipmentIdentifier:
+		s.gasEquipmentIdentifier = ParseEquipmentIdentifier(o.Values[0])
+		s.rawGasEquipmentIdentifier = o.Values[0].Value
+		return interpretValue("gas equipment identifier", s.gasEquipmentIdentifier), nil
 
-		case gop1.OBISTypeElectricityGeneratedTariff2:
-			v, err := ParseEnergy(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeElectricityDeliveredTariff1:
+		v, err := ParseEnergy(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.totalElectricityInjected[2] = v
+		s.totalElectricityDelivered[1] = v
+		return interpretQuantity("delivered, tariff 1", v, "Wh"), nil
 
-		case gop1.OBISTypeElectricityTariffIndicator:
-			v, err := ParseElectricityTariffIndicator(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeElectricityDeliveredTariff2:
+		v, err := ParseEnergy(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.electricityTariffIndicator = v
+		s.totalElectricityDelivered[2] = v
+		return interpretQuantity("delivered, tariff 2", v, "Wh"), nil
 
-		case gop1.OBISTypeElectricityDelivered:
-			v, err := ParsePower(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeElectricityGeneratedTariff1:
+		v, err := ParseEnergy(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.electricPowerDelivered = v
+		s.totalElectricityInjected[1] = v
+		return interpretQuantity("injected, tariff 1", v, "Wh"), nil
 
-		case gop1.OBISTypeElectricityGenerated:
-			v, err := ParsePower(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeElectricityGeneratedTariff2:
+		v, err := ParseEnergy(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.electricPowerInjected = v
+		s.totalElectricityInjected[2] = v
+		return interpretQuantity("injected, tariff 2", v, "Wh"), nil
 
-		case gop1.OBISTypeInstantaneousVoltageL1:
-			v, err := ParseVoltage(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeElectricityTariffIndicator:
+		v, err := ParseElectricityTariffIndicator(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.voltage["l1"] = v
+		s.electricityTariffIndicator = v
+		return interpretValue("tariff", v), nil
 
-		case gop1.OBISTypeInstantaneousVoltageL2:
-			v, err := ParseVoltage(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeElectricityDelivered:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.voltage["l2"] = v
+		s.electricPowerDelivered = v
+		return interpretQuantity("power delivered", v, "W"), nil
 
-		case gop1.OBISTypeInstantaneousVoltageL3:
-			v, err := ParseVoltage(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeElectricityGenerated:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.voltage["l3"] = v
+		s.electricPowerInjected = v
+		return interpretQuantity("power injected", v, "W"), nil
 
-		case gop1.OBISTypeInstantaneousCurrentL1:
-			v, err := ParseElectricCurrent(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeInstantaneousPowerDeliveredL1:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.electricCurrent["l1"] = v
+		s.phasePowerDelivered["l1"] = v
+		return interpretQuantity("power delivered, l1", v, "W"), nil
 
-		case gop1.OBISTypeInstantaneousCurrentL2:
-			v, err := ParseElectricCurrent(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeInstantaneousPowerDeliveredL2:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.electricCurrent["l2"] = v
+		s.phasePowerDelivered["l2"] = v
+		return interpretQuantity("power delivered, l2", v, "W"), nil
 
-		case gop1.OBISTypeInstantaneousCurrentL3:
-			v, err := ParseElectricCurrent(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeInstantaneousPowerDeliveredL3:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.electricCurrent["l3"] = v
+		s.phasePowerDelivered["l3"] = v
+		return interpretQuantity("power delivered, l3", v, "W"), nil
 
-		case gop1.OBISTypeGasDelivered:
-			{
-				v, err := ParseTimestamp(o.Values[0])
-				if err != nil {
-					return err
-				}
+	case gop1.OBISTypeInstantaneousPowerGeneratedL1:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-				s.totalGasDeliveredTimestamp = v
-			}
+		s.phasePowerInjected["l1"] = v
+		return interpretQuantity("power injected, l1", v, "W"), nil
 
-			{
-				v, err := ParseVolume(o.Values[1])
-				if err != nil {
-					return err
-				}
+	case gop1.OBISTypeInstantaneousPowerGeneratedL2:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-				s.totalGasDelivered = v
-			}
+		s.phasePowerInjected["l2"] = v
+		return interpretQuantity("power injected, l2", v, "W"), nil
 
-		case gop1.OBISTypeBreakerState:
-			v, err := ParseBreakerState(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeInstantaneousPowerGeneratedL3:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.breakerState = v
+		s.phasePowerInjected["l3"] = v
+		return interpretQuantity("power injected, l3", v, "W"), nil
 
-		case gop1.OBISTypeLimiterThreshold:
-			v, err := ParsePower(o.Values[0])
-			if err != nil {
-				return err
-			}
+	case gop1.OBISTypeInstantaneousVoltageL1:
+		v, err := ParseVoltage(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		s.voltage["l1"] = v
+		return interpretQuantity("voltage, l1", v, "V"), nil
+
+	case gop1.OBISTypeInstantaneousVoltageL2:
+		v, err := ParseVoltage(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		s.voltage["l2"] = v
+		return interpretQuantity("voltage, l2", v, "V"), nil
+
+	case gop1.OBISTypeInstantaneousVoltageL3:
+		v, err := ParseVoltage(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		s.voltage["l3"] = v
+		return interpretQuantity("voltage, l3", v, "V"), nil
+
+	case gop1.OBISTypeInstantaneousCurrentL1:
+		v, err := ParseElectricCurrent(o.Values[0])
+		if err != nil {
+			return "", err
+		}
 
-			s.electricityLimiterThreshold = v
+		s.electricCurrent["l1"] = v
+		return interpretQuantity("current, l1", v, "A"), nil
 
-		case gop1.OBISTypeFuseThresholdL1:
-			v, err := ParseElectricCurrent(o.Values[0])
+	case gop1.OBISTypeInstantaneousCurrentL2:
+		v, err := ParseElectricCurrent(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		s.electricCurrent["l2"] = v
+		return interpretQuantity("current, l2", v, "A"), nil
+
+	case gop1.OBISTypeInstantaneousCurrentL3:
+		v, err := ParseElectricCurrent(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		s.electricCurrent["l3"] = v
+		return interpretQuantity("current, l3", v, "A"), nil
+
+	case gop1.OBISTypeGasDelivered:
+		if len(o.Values) < 2 {
+			return "", ErrMissingTelegramValue
+		}
+
+		{
+			v, err := ParseTimestamp(o.Values[0])
 			if err != nil {
-				return err
+				return "", err
 			}
 
-			s.fuseThreshold["l1"] = v
+			s.totalGasDeliveredTimestamp = v
+		}
 
-		case gop1.OBISTypeGasValveState:
-			v, err := ParseGasValveState(o.Values[0])
+		{
+			v, err := ParseVolume(o.Values[1])
 			if err != nil {
-				return err
+				return "", err
 			}
 
-			s.gasValveState = v
+			s.totalGasDelivered = v
+		}
+
+		s.gasFlowMeter.Update(
+			s.totalGasDeliveredTimestamp,
+			s.totalGasDelivered,
+		)
+
+		return fmt.Sprintf(
+			"%s at %v",
+			interpretQuantity("gas delivered", s.totalGasDelivered, "m3"),
+			s.totalGasDeliveredTimestamp,
+		), nil
+
+	case gop1.OBISTypeBreakerState:
+		v, err := ParseBreakerState(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		if s.breakerStateObserved && v != s.breakerState {
+			s.Logger.Infof(
+				"breaker state changed from %v to %v",
+				s.breakerState,
+				v,
+			)
+
+			s.changeState("breaker", s.breakerState, v)
+		}
+
+		s.breakerState = v
+		s.breakerStateObserved = true
+		return interpretValue("breaker state", v), nil
+
+	case gop1.OBISTypeLimiterThreshold:
+		v, err := ParsePower(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		s.electricityLimiterThreshold = v
+		return interpretQuantity("limiter threshold", v, "W"), nil
+
+	case gop1.OBISTypeFuseThresholdL1:
+		v, err := ParseElectricCurrent(o.Values[0])
+		if err != nil {
+			return "", err
+		}
+
+		s.fuseThreshold["l1"] = v
+		return interpretQuantity("fuse threshold, l1", v, "A"), nil
+
+	case gop1.OBISTypeGasValveState:
+		v, err := ParseGasValveState(o.Values[0])
+		if err != nil {
+			return "", err
 		}
+
+		if s.gasValveStateObserved && v != s.gasValveState {
+			s.Logger.Infof(
+				"gas valve state changed from %v to %v",
+				s.gasValveState,
+				v,
+			)
+
+			s.changeState("gas_valve", s.gasValveState, v)
+		}
+
+		s.gasValveState = v
+		s.gasValveStateObserved = true
+		return interpretValue("gas valve state", v), nil
 	}
 
-	return nil
+	return "", nil
+}
+
+// changeState records a state change, so that it's published with the
+// snapshot of the current telegram.
+func (s *P1State) changeState(device string, from, to fmt.Stringer) {
+	s.stateChanges = append(s.stateChanges, StateChange{
+		Timestamp: s.timestamp,
+		Device:    device,
+		From:      from.String(),
+		To:        to.String(),
+	})
+}
+
+func (s *P1State) updateDemand() {
+	var e Energy
+	for _, v := range s.totalElectricityDelivered {
+		e += v
+	}
+
+	p, t := s.demand.Peak()
+	s.demand.Update(s.meterTimestamp, e)
+
+	// The month's peak is what the capacity tariff is billed on.
+	if q, u := s.demand.Peak(); q != p || !u.Equal(t) {
+		s.requestCheckpoint()
+	}
+}
+
+func (s *P1State) updateCost() {
+	if s.Prices == nil {
+		return
+	}
+
+	s.cost.Update(
+		s.Prices,
+		s.meterTimestamp,
+		s.totalElectricityDelivered,
+		s.totalElectricityInjected,
+		s.totalGasDelivered,
+	)
+}
+
+func (s *P1State) updatePeriods() {
+	v := PeriodTotals{
+		Delivered: s.totalElectricityDelivered,
+		Injected:  s.totalElectricityInjected,
+	}
+
+	if s.gasEquipmentIdentifier != "" {
+		v.Gas = s.totalGasDelivered
+	}
+
+	s.periods.Update(s.meterTimestamp, v)
 }
 
-func NewP1State(l log.Logger, p1 *gop1.P1) *P1State {
+func NewP1State(
+	l log.Logger,
+	p1 *Reader,
+	st *Storage,
+	pr *Prices,
+) *P1State {
 	return &P1State{
-		Logger: l,
-		P1:     p1,
+		Logger:  l,
+		P1:      p1,
+		Storage: st,
+		Prices:  pr,
 
 		totalElectricityDelivered: make(map[int]Energy),
 		totalElectricityInjected:  make(map[int]Energy),
+		phasePowerDelivered:       make(map[string]Power),
+		phasePowerInjected:        make(map[string]Power),
 		electricCurrent:           make(map[string]ElectricCurrent),
 		voltage:                   make(map[string]Voltage),
 		fuseThreshold:             make(map[string]ElectricCurrent),
+		checkpointRequests:        make(chan struct{}, 1),
 	}
 }
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestHandleTelegramInvalidHeader(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	err := s.handleTelegram(ParseTelegram(
+		"/X\r\n" +
+			"\r\n" +
+			"0-0:96.1.4(50217)\r\n" +
+			"0-0:1.0.0(210204163628W)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n" +
+			"!1234\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	v := s.Snapshot()
+	if v.Version != 50217 {
+		t.Errorf("Version = %d, want 50217", v.Version)
+	}
+
+	if v.TotalElectricityDelivered[1] != 123456 {
+		t.Errorf("TotalElectricityDelivered[1] = %v, want 123456", v.TotalElectricityDelivered[1])
+	}
+}
+
+func TestHandleTelegramUnobservedStates(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	err := s.handleTelegram(ParseTelegram(
+		"/KFM5KAIFA-METER\r\n" +
+			"0-0:1.0.0(210204163628W)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	v := s.Snapshot()
+	if v.BreakerStateObserved || v.GasValveStateObserved {
+		t.Errorf("states observed without being reported")
+	}
+
+	err = s.handleTelegram(ParseTelegram(
+		"/KFM5KAIFA-METER\r\n" +
+			"0-0:1.0.0(210204163638W)\r\n" +
+			"0-0:96.3.10(0)\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	v = s.Snapshot()
+	if !v.BreakerStateObserved || v.BreakerState != BreakerStateDisconnected {
+		t.Errorf("BreakerState = %v, %v, want disconnected", v.BreakerState, v.BreakerStateObserved)
+	}
+}
+
+func TestHandleTelegramStateChanges(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	telegrams := []struct {
+		timestamp string
+		breaker   string
+		valve     string
+		changes   []StateChange
+	}{
+		{"210204163628W", "1", "1", nil},
+		{"210204163638W", "1", "1", nil},
+		{
+			"210204163648W", "0", "1",
+			[]StateChange{
+				{
+					Device: "breaker",
+					From:   "connected",
+					To:     "disconnected",
+				},
+			},
+		},
+		{
+			"210204163658W", "2", "2",
+			[]StateChange{
+				{
+					Device: "breaker",
+					From:   "disconnected",
+					To:     "ready_for_reconnection",
+				},
+				{
+					Device: "gas_valve",
+					From:   "connected",
+					To:     "ready_for_reconnection",
+				},
+			},
+		},
+		{"210204163708W", "2", "2", nil},
+	}
+
+	for _, tt := range telegrams {
+		err := s.handleTelegram(ParseTelegram(
+			"/KFM5KAIFA-METER\r\n" +
+				"0-0:1.0.0(" + tt.timestamp + ")\r\n" +
+				"0-0:96.3.10(" + tt.breaker + ")\r\n" +
+				"0-1:24.4.0(" + tt.valve + ")\r\n",
+		))
+
+		if err != nil {
+			t.Fatalf("handleTelegram() error = %v", err)
+		}
+
+		sn := s.Snapshot()
+		v := sn.StateChanges
+		if len(v) != len(tt.changes) {
+			t.Errorf("%s: StateChanges = %v, want %v", tt.timestamp, v, tt.changes)
+			continue
+		}
+
+		for i := range v {
+			if !v[i].Timestamp.Equal(sn.Timestamp) {
+				t.Errorf("%s: StateChanges[%d].Timestamp = %v, want %v", tt.timestamp, i, v[i].Timestamp, sn.Timestamp)
+			}
+
+			v[i].Timestamp = time.Time{}
+			if v[i] != tt.changes[i] {
+				t.Errorf("%s: StateChanges[%d] = %v, want %v", tt.timestamp, i, v[i], tt.changes[i])
+			}
+		}
+	}
+}
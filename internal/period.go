@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"time"
+)
+
+// Periods are reported by name, the current period followed by the previous
+// one.
+const (
+	PeriodToday     = "today"
+	PeriodYesterday = "yesterday"
+	PeriodThisWeek  = "this_week"
+	PeriodLastWeek  = "last_week"
+	PeriodThisMonth = "this_month"
+	PeriodLastMonth = "last_month"
+)
+
+// PeriodTotals holds the energy and volume delivered and injected in a
+// period, or the counters at its start.
+type PeriodTotals struct {
+	Delivered map[int]Energy `json:"delivered"`
+	Injected  map[int]Energy `json:"injected"`
+	Gas       Volume         `json:"gas"`
+}
+
+func (p PeriodTotals) sub(q PeriodTotals) PeriodTotals {
+	r := PeriodTotals{
+		Delivered: make(map[int]Energy, len(p.Delivered)),
+		Injected:  make(map[int]Energy, len(p.Injected)),
+	}
+
+	for k, v := range p.Delivered {
+		if u, ok := q.Delivered[k]; ok {
+			r.Delivered[k] = v - u
+		}
+	}
+
+	for k, v := range p.Injected {
+		if u, ok := q.Injected[k]; ok {
+			r.Injected[k] = v - u
+		}
+	}
+
+	if q.Gas > 0 {
+		r.Gas = p.Gas - q.Gas
+	}
+
+	return r
+}
+
+// interpolate returns the totals at t, assuming they increased at a constant
+// rate from p at tp to q at tq. Counters which p doesn't have are taken from q.
+func (p PeriodTotals) interpolate(tp time.Time, q PeriodTotals, tq time.Time, t time.Time) PeriodTotals {
+	f := float64(t.Sub(tp)) / float64(tq.Sub(tp))
+
+	r := PeriodTotals{
+		Delivered: make(map[int]Energy, len(q.Delivered)),
+		Injected:  make(map[int]Energy, len(q.Injected)),
+		Gas:       q.Gas,
+	}
+
+	for k, v := range q.Delivered {
+		r.Delivered[k] = v
+		if u, ok := p.Delivered[k]; ok {
+			r.Delivered[k] = u + Energy(f*float64(v-u))
+		}
+	}
+
+	for k, v := range q.Injected {
+		r.Injected[k] = v
+		if u, ok := p.Injected[k]; ok {
+			r.Injected[k] = u + Energy(f*float64(v-u))
+		}
+	}
+
+	if p.Gas > 0 {
+		r.Gas = p.Gas + Volume(f*float64(q.Gas-p.Gas))
+	}
+
+	return r
+}
+
+func (p PeriodTotals) clone() PeriodTotals {
+	p.Delivered = copyMap(p.Delivered)
+	p.Injected = copyMap(p.Injected)
+
+	return p
+}
+
+// periodTracker keeps the counters at the start of the current day, week and
+// month in the meter's zone, along with the totals of the previous ones.
+type periodTracker struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Counters  PeriodTotals  `json:"counters"`
+	Day       periodCounter `json:"day"`
+	Week      periodCounter `json:"week"`
+	Month     periodCounter `json:"month"`
+}
+
+type periodCounter struct {
+	Start    time.Time     `json:"start"`
+	Complete bool          `json:"complete"`
+	Counters PeriodTotals  `json:"counters"`
+	Previous *PeriodTotals `json:"previous"`
+}
+
+func (p *periodTracker) Update(t time.Time, v PeriodTotals) {
+	if !t.After(p.Timestamp) {
+		return
+	}
+
+	// Telegrams rarely arrive right at a boundary, and none do while the
+	// exporter isn't running. The counters at boundaries in between are
+	// interpolated from the ones of the previous telegram.
+	var at func(time.Time) PeriodTotals
+	if !p.Timestamp.IsZero() {
+		at = func(b time.Time) PeriodTotals {
+			return p.Counters.interpolate(p.Timestamp, v, t, b)
+		}
+	}
+
+	p.Day.update(dayStart, t, v, at)
+	p.Week.update(weekStart, t, v, at)
+	p.Month.update(monthStart, t, v, at)
+
+	p.Timestamp = t
+	p.Counters = v.clone()
+}
+
+// Totals returns the totals of the periods which started since the first
+// telegram, up to now for the current ones.
+func (p *periodTracker) Totals() map[string]PeriodTotals {
+	r := make(map[string]PeriodTotals)
+
+	p.Day.totals(r, PeriodToday, PeriodYesterday, p.Counters)
+	p.Week.totals(r, PeriodThisWeek, PeriodLastWeek, p.Counters)
+	p.Month.totals(r, PeriodThisMonth, PeriodLastMonth, p.Counters)
+
+	return r
+}
+
+func (p periodTracker) clone() periodTracker {
+	p.Counters = p.Counters.clone()
+	p.Day = p.Day.clone()
+	p.Week = p.Week.clone()
+	p.Month = p.Month.clone()
+
+	return p
+}
+
+// update moves on to the period containing t, at returns the counters at a
+// boundary since the previous telegram or is nil if there was none.
+func (c *periodCounter) update(
+	start func(time.Time, int) time.Time,
+	t time.Time,
+	v PeriodTotals,
+	at func(time.Time) PeriodTotals,
+) {
+	s := start(t, 0)
+	if !s.After(c.Start) {
+		return
+	}
+
+	if at == nil {
+		c.Start = s
+		c.Complete = false
+		c.Counters = v.clone()
+		c.Previous = nil
+
+		return
+	}
+
+	u := at(s)
+
+	// The previous period either is the current one, or it started after the
+	// previous telegram as well.
+	c.Previous = nil
+	switch q := start(s, -1); {
+	case q.Equal(c.Start) && c.Complete:
+		d := u.sub(c.Counters)
+		c.Previous = &d
+
+	case q.After(c.Start):
+		d := u.sub(at(q))
+		c.Previous = &d
+	}
+
+	c.Start = s
+	c.Complete = true
+	c.Counters = u
+}
+
+func (c *periodCounter) totals(
+	r map[string]PeriodTotals,
+	current string,
+	previous string,
+	v PeriodTotals,
+) {
+	if c.Complete {
+		r[current] = v.sub(c.Counters)
+	}
+
+	if c.Previous != nil {
+		r[previous] = c.Previous.clone()
+	}
+}
+
+func (c periodCounter) clone() periodCounter {
+	c.Counters = c.Counters.clone()
+	if c.Previous != nil {
+		p := c.Previous.clone()
+		c.Previous = &p
+	}
+
+	return c
+}
+
+// dayStart returns the start of the n-th day after the one containing t.
+func dayStart(t time.Time, n int) time.Time {
+	y, m, d := meterTime(t).Date()
+	return meterDate(y, m, d+n)
+}
+
+// weekStart returns the start of the n-th week after the one containing t,
+// weeks starting on Monday.
+func weekStart(t time.Time, n int) time.Time {
+	t = meterTime(t)
+	y, m, d := t.Date()
+
+	return meterDate(y, m, d-(int(t.Weekday())+6)%7+7*n)
+}
+
+// monthStart returns the start of the n-th month after the one containing t.
+func monthStart(t time.Time, n int) time.Time {
+	y, m, _ := meterTime(t).Date()
+	return meterDate(y, m+time.Month(n), 1)
+}
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodStarts(t *testing.T) {
+	utc := func(y int, m time.Month, d, h int) time.Time {
+		return time.Date(y, m, d, h, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		start func(time.Time, int) time.Time
+		t     time.Time
+		n     int
+		want  time.Time
+	}{
+		{"day", dayStart, utc(2024, 1, 15, 12), 0, utc(2024, 1, 14, 23)},
+		{"day before midnight", dayStart, utc(2024, 1, 15, 22), 1, utc(2024, 1, 15, 23)},
+		{"day after midnight", dayStart, utc(2024, 1, 15, 23), 0, utc(2024, 1, 15, 23)},
+		{"day of summer time", dayStart, utc(2024, 3, 31, 12), 1, utc(2024, 3, 31, 22)},
+		{"day of winter time", dayStart, utc(2024, 10, 27, 12), 0, utc(2024, 10, 26, 22)},
+		{"day after winter time", dayStart, utc(2024, 10, 27, 12), 1, utc(2024, 10, 27, 23)},
+		{"week on Monday", weekStart, utc(2024, 1, 15, 12), 0, utc(2024, 1, 14, 23)},
+		{"week on Sunday", weekStart, utc(2024, 1, 21, 12), 0, utc(2024, 1, 14, 23)},
+		{"previous week", weekStart, utc(2024, 1, 17, 12), -1, utc(2024, 1, 7, 23)},
+		{"week across summer time", weekStart, utc(2024, 3, 30, 12), 1, utc(2024, 3, 31, 22)},
+		{"month", monthStart, utc(2024, 2, 29, 12), 0, utc(2024, 1, 31, 23)},
+		{"next month", monthStart, utc(2024, 3, 15, 12), 1, utc(2024, 3, 31, 22)},
+		{"previous year", monthStart, utc(2024, 1, 15, 12), -1, utc(2023, 11, 30, 23)},
+	}
+
+	for _, tt := range tests {
+		if got := tt.start(tt.t, tt.n); !got.Equal(tt.want) {
+			t.Errorf("%s: start(%v, %d) = %v, want %v", tt.name, tt.t, tt.n, got.UTC(), tt.want)
+		}
+	}
+}
+
+func energyPtr(e Energy) *Energy {
+	return &e
+}
+
+func periodTotals(e Energy) PeriodTotals {
+	return PeriodTotals{
+		Delivered: map[int]Energy{1: e},
+		Injected:  map[int]Energy{1: 0},
+	}
+}
+
+func TestPeriodCounterUpdate(t *testing.T) {
+	day := func(d, h int) time.Time {
+		return time.Date(2024, 1, d, h, 0, 0, 0, cet)
+	}
+
+	tests := []struct {
+		name     string
+		counter  periodCounter
+		last     time.Time
+		lastV    Energy
+		t        time.Time
+		v        Energy
+		complete bool
+		start    Energy
+		previous *Energy
+	}{
+		{
+			name:  "first telegram",
+			t:     day(15, 12),
+			v:     1000,
+			start: 1000,
+		},
+		{
+			name:     "same period",
+			counter:  periodCounter{Start: day(15, 0), Complete: true, Counters: periodTotals(900)},
+			last:     day(15, 11),
+			lastV:    990,
+			t:        day(15, 12),
+			v:        1000,
+			complete: true,
+			start:    900,
+		},
+		{
+			name:     "next period",
+			counter:  periodCounter{Start: day(15, 0), Complete: true, Counters: periodTotals(900)},
+			last:     day(15, 23),
+			lastV:    990,
+			t:        day(16, 1),
+			v:        1010,
+			complete: true,
+			start:    1000,
+			previous: energyPtr(100),
+		},
+		{
+			name:     "next period of an incomplete one",
+			counter:  periodCounter{Start: day(15, 0), Counters: periodTotals(950)},
+			last:     day(15, 23),
+			lastV:    990,
+			t:        day(16, 1),
+			v:        1010,
+			complete: true,
+			start:    1000,
+		},
+		{
+			name:     "across a gap",
+			counter:  periodCounter{Start: day(15, 0), Complete: true, Counters: periodTotals(900)},
+			last:     day(15, 12),
+			lastV:    960,
+			t:        day(17, 12),
+			v:        1440,
+			complete: true,
+			start:    1320,
+			previous: energyPtr(240),
+		},
+	}
+
+	for _, tt := range tests {
+		c := tt.counter
+
+		var at func(time.Time) PeriodTotals
+		if !tt.last.IsZero() {
+			at = func(b time.Time) PeriodTotals {
+				return periodTotals(tt.lastV).interpolate(tt.last, periodTotals(tt.v), tt.t, b)
+			}
+		}
+
+		c.update(dayStart, tt.t, periodTotals(tt.v), at)
+
+		if c.Complete != tt.complete {
+			t.Errorf("%s: Complete = %v, want %v", tt.name, c.Complete, tt.complete)
+		}
+
+		if v := c.Counters.Delivered[1]; v != tt.start {
+			t.Errorf("%s: counters = %v, want %v", tt.name, v, tt.start)
+		}
+
+		switch {
+		case tt.previous == nil && c.Previous != nil:
+			t.Errorf("%s: previous = %v, want none", tt.name, c.Previous.Delivered[1])
+		case tt.previous != nil && c.Previous == nil:
+			t.Errorf("%s: previous = none, want %v", tt.name, *tt.previous)
+		case tt.previous != nil && c.Previous.Delivered[1] != *tt.previous:
+			t.Errorf("%s: previous = %v, want %v", tt.name, c.Previous.Delivered[1], *tt.previous)
+		}
+	}
+}
+
+func TestPeriodTrackerGap(t *testing.T) {
+	var p periodTracker
+
+	// The exporter was stopped from Sunday evening until Tuesday morning.
+	p.Update(time.Date(2024, 1, 14, 20, 0, 0, 0, cet), periodTotals(1000))
+	p.Update(time.Date(2024, 1, 16, 4, 0, 0, 0, cet), periodTotals(1320))
+	p.Update(time.Date(2024, 1, 16, 12, 0, 0, 0, cet), periodTotals(1400))
+
+	r := p.Totals()
+
+	tests := map[string]Energy{
+		PeriodToday:     120,
+		PeriodYesterday: 240,
+		PeriodThisWeek:  360,
+	}
+
+	for k, v := range tests {
+		if got := r[k].Delivered[1]; got != v {
+			t.Errorf("%s = %v, want %v", k, got, v)
+		}
+	}
+
+	if _, ok := r[PeriodLastWeek]; ok {
+		t.Errorf("%s reported, want none", PeriodLastWeek)
+	}
+}
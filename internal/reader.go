@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+type ReaderConfig struct {
+	USBDevice string
+	Baudrate  int
+	Timeout   int
+}
+
+// Reader reads telegrams from the smart meter's serial device. Unlike gop1, it
+// keeps the raw telegram around.
+type Reader struct {
+	Incoming chan *Telegram
+
+	port io.Reader
+}
+
+func (r *Reader) Start() {
+	go r.read()
+}
+
+func (r *Reader) read() {
+	var (
+		b = bufio.NewReader(r.port)
+		t strings.Builder
+		l string
+	)
+
+	for {
+		s, err := b.ReadString('\n')
+		l += s
+
+		// Reads time out while the meter is idle, the remainder of the line
+		// follows in the next read.
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(l, "/"):
+			t.Reset()
+		case t.Len() == 0:
+			l = ""
+			continue
+		}
+
+		t.WriteString(l)
+		if strings.HasPrefix(l, "!") {
+			r.Incoming <- ParseTelegram(t.String())
+			t.Reset()
+		}
+
+		l = ""
+	}
+}
+
+func NewReader(c ReaderConfig) (*Reader, error) {
+	if c.Baudrate <= 0 {
+		c.Baudrate = 115200
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = 500
+	}
+
+	p, err := serial.OpenPort(
+		&serial.Config{
+			Name:        c.USBDevice,
+			Baud:        c.Baudrate,
+			ReadTimeout: time.Duration(c.Timeout) * time.Millisecond,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		Incoming: make(chan *Telegram),
+		port:     p,
+	}, nil
+}
@@ -0,0 +1,534 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	remoteWriteName       = "remote_write.jsonl"
+	remoteWriteTimeout    = 30 * time.Second
+	legacyRemoteWriteName = "remote_write.json"
+)
+
+var (
+	ErrInvalidRemoteWriteBatchSize = errors.New("invalid remote write batch size")
+	ErrInvalidRemoteWriteQueueSize = errors.New("remote write queue size is smaller than the batch size")
+	ErrInvalidRemoteWriteInterval  = errors.New("invalid remote write interval")
+)
+
+var (
+	remoteWritePendingDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "remote_write", "pending_samples"),
+		"Number of samples queued to be sent.",
+		nil,
+		nil,
+	)
+
+	remoteWriteSentDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "remote_write", "sent_samples_total"),
+		"Total number of samples sent.",
+		nil,
+		nil,
+	)
+
+	remoteWriteRetriedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "remote_write", "retried_samples_total"),
+		"Total number of samples which failed to be sent and were queued again.",
+		nil,
+		nil,
+	)
+
+	remoteWriteFailedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "remote_write", "failed_samples_total"),
+		"Total number of samples rejected by the remote endpoint.",
+		nil,
+		nil,
+	)
+
+	remoteWriteDroppedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "remote_write", "dropped_samples_total"),
+		"Total number of samples dropped because the queue was full.",
+		nil,
+		nil,
+	)
+)
+
+type RemoteWriteConfig struct {
+	URL         string
+	Username    string
+	Password    string
+	BearerToken string
+	Headers     map[string]string
+	Interval    time.Duration
+	BatchSize   int
+	QueueSize   int
+}
+
+type remoteWriteLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type remoteWriteSample struct {
+	Labels    []remoteWriteLabel `json:"labels"`
+	Value     float64            `json:"value"`
+	Timestamp int64              `json:"timestamp"`
+}
+
+// RemoteWriter periodically gathers metrics and pushes them to a Prometheus
+// remote-write endpoint, for meters which can't be scraped. Samples which
+// couldn't be sent are queued, and persisted when storage is configured.
+type RemoteWriter struct {
+	Logger   log.Logger
+	Gatherer prometheus.Gatherer
+	Storage  *Storage
+	Config   RemoteWriteConfig
+
+	client  *http.Client
+	mutex   sync.Mutex
+	queue   []remoteWriteSample
+	sent    int
+	retried int
+	failed  int
+	dropped int
+	segment int
+}
+
+func (w *RemoteWriter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- remoteWritePendingDesc
+	ch <- remoteWriteSentDesc
+	ch <- remoteWriteRetriedDesc
+	ch <- remoteWriteFailedDesc
+	ch <- remoteWriteDroppedDesc
+}
+
+func (w *RemoteWriter) Collect(ch chan<- prometheus.Metric) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(
+		remoteWritePendingDesc,
+		prometheus.GaugeValue,
+		float64(len(w.queue)),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		remoteWriteSentDesc,
+		prometheus.CounterValue,
+		float64(w.sent),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		remoteWriteRetriedDesc,
+		prometheus.CounterValue,
+		float64(w.retried),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		remoteWriteFailedDesc,
+		prometheus.CounterValue,
+		float64(w.failed),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		remoteWriteDroppedDesc,
+		prometheus.CounterValue,
+		float64(w.dropped),
+	)
+}
+
+func (w *RemoteWriter) Start() {
+	if w.Storage != nil {
+		if err := w.restore(); err != nil {
+			w.Logger.Errorln(err)
+		}
+	}
+
+	t := time.NewTicker(w.Config.Interval)
+	defer t.Stop()
+
+	for range t.C {
+		if err := w.gather(); err != nil {
+			w.Logger.Errorln("unable to gather metrics:", err)
+		}
+
+		n := w.removed()
+		if err := w.flush(); err != nil {
+			w.Logger.Errorln("unable to send metrics:", err)
+		}
+
+		if w.Storage != nil {
+			if err := w.compact(w.removed() != n); err != nil {
+				w.Logger.Errorln(err)
+			}
+		}
+	}
+}
+
+func (w *RemoteWriter) gather() error {
+	mfs, err := w.Gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now().UnixMilli()
+
+	var ss []remoteWriteSample
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			var v float64
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				v = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				v = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				v = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+
+			ls := []remoteWriteLabel{{Name: "__name__", Value: mf.GetName()}}
+			for _, l := range m.GetLabel() {
+				ls = append(ls, remoteWriteLabel{Name: l.GetName(), Value: l.GetValue()})
+			}
+
+			sort.Slice(ls, func(i, j int) bool {
+				return ls[i].Name < ls[j].Name
+			})
+
+			s := remoteWriteSample{Labels: ls, Value: v, Timestamp: ts}
+			if m.TimestampMs != nil {
+				s.Timestamp = m.GetTimestampMs()
+			}
+
+			ss = append(ss, s)
+		}
+	}
+
+	w.mutex.Lock()
+	w.queue = append(w.queue, ss...)
+	w.trim()
+	w.mutex.Unlock()
+
+	if w.Storage != nil {
+		if err := w.append(ss); err != nil {
+			w.Logger.Errorln("unable to persist samples:", err)
+		}
+	}
+
+	return nil
+}
+
+// removed returns how many samples left the queue after they were sent or
+// rejected.
+func (w *RemoteWriter) removed() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.sent + w.failed
+}
+
+func (w *RemoteWriter) trim() {
+	if n := len(w.queue) - w.Config.QueueSize; n > 0 {
+		w.queue = w.queue[n:]
+		w.dropped += n
+	}
+}
+
+func (w *RemoteWriter) flush() error {
+	for {
+		w.mutex.Lock()
+		n := min(len(w.queue), w.Config.BatchSize)
+		b := w.queue[:n:n]
+		w.queue = w.queue[n:]
+		w.mutex.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		retry, err := w.send(b)
+
+		w.mutex.Lock()
+		switch {
+		case err == nil:
+			w.sent += n
+
+		case retry:
+			w.retried += n
+			w.queue = append(b, w.queue...)
+			w.trim()
+
+		default:
+			w.failed += n
+		}
+
+		w.mutex.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// send pushes a batch of samples, reporting whether the batch should be
+// retried when it fails.
+func (w *RemoteWriter) send(ss []remoteWriteSample) (bool, error) {
+	req, err := http.NewRequest(
+		http.MethodPost,
+		w.Config.URL,
+		bytes.NewReader(snappy.Encode(nil, encodeWriteRequest(ss))),
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	for k, v := range w.Config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "p1_exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	switch {
+	case w.Config.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+w.Config.BearerToken)
+
+	case w.Config.Username != "":
+		req.SetBasicAuth(w.Config.Username, w.Config.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(b))
+
+	// Rejected samples won't be accepted the next time either.
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
+
+// append writes newly queued samples to the end of the segment, rather than
+// rewriting the whole queue every interval.
+func (w *RemoteWriter) append(ss []remoteWriteSample) error {
+	if len(ss) == 0 {
+		return nil
+	}
+
+	b, err := encodeSegment(ss)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Storage.Append(remoteWriteName, b); err != nil {
+		// Part of the samples may have been written, the segment has to be
+		// rewritten to be sure it matches the queue again.
+		w.segment = -1
+		return err
+	}
+
+	if w.segment >= 0 {
+		w.segment += len(ss)
+	}
+
+	return nil
+}
+
+// compact truncates the segment once everything in it has been sent. The
+// queue is always its tail, so the samples which were sent or dropped are only
+// removed from it when they'd otherwise be sent again after a restart, or when
+// they take up as much space as a full queue.
+func (w *RemoteWriter) compact(progressed bool) error {
+	w.mutex.Lock()
+	q := w.queue[:len(w.queue):len(w.queue)]
+	w.mutex.Unlock()
+
+	// The segment is unknown after a failed write, and has to be rewritten.
+	if w.segment >= 0 {
+		n := w.segment - len(q)
+		if n == 0 || len(q) > 0 && !progressed && n < w.Config.QueueSize {
+			return nil
+		}
+	}
+
+	return w.rewrite(q)
+}
+
+func (w *RemoteWriter) rewrite(q []remoteWriteSample) error {
+	if len(q) == 0 {
+		w.segment = 0
+		return w.Storage.Remove(remoteWriteName)
+	}
+
+	b, err := encodeSegment(q)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Storage.Write(remoteWriteName, b); err != nil {
+		w.segment = -1
+		return err
+	}
+
+	w.segment = len(q)
+	return nil
+}
+
+func (w *RemoteWriter) restore() error {
+	q, err := w.restoreSegment()
+	if err != nil {
+		return err
+	}
+
+	// Queues used to be saved as a whole.
+	var l []remoteWriteSample
+	if err := w.Storage.Load(legacyRemoteWriteName, &l); err == nil {
+		q = append(l, q...)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	w.mutex.Lock()
+	w.queue = append(q, w.queue...)
+	w.trim()
+	q = w.queue[:len(w.queue):len(w.queue)]
+	w.mutex.Unlock()
+
+	// Start over from a segment which holds just the queue, a torn write may
+	// have been left at its end.
+	if err := w.rewrite(q); err != nil {
+		return err
+	}
+
+	return w.Storage.Remove(legacyRemoteWriteName)
+}
+
+func (w *RemoteWriter) restoreSegment() ([]remoteWriteSample, error) {
+	b, err := w.Storage.Read(remoteWriteName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var (
+		q []remoteWriteSample
+		d = json.NewDecoder(bytes.NewReader(b))
+	)
+
+	for d.More() {
+		var s remoteWriteSample
+		if err := d.Decode(&s); err != nil {
+			w.Logger.Warnln("ignoring the end of the remote write segment:", err)
+			break
+		}
+
+		q = append(q, s)
+	}
+
+	return q, nil
+}
+
+func encodeSegment(ss []remoteWriteSample) ([]byte, error) {
+	var b bytes.Buffer
+
+	e := json.NewEncoder(&b)
+	for _, s := range ss {
+		if err := e.Encode(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// encodeWriteRequest encodes the samples as a prometheus.WriteRequest, with
+// a time series per sample.
+func encodeWriteRequest(ss []remoteWriteSample) []byte {
+	var b []byte
+	for _, s := range ss {
+		var ts []byte
+		for _, l := range s.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sb)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+
+	return b
+}
+
+func NewRemoteWriter(
+	l log.Logger,
+	g prometheus.Gatherer,
+	st *Storage,
+	c RemoteWriteConfig,
+) (*RemoteWriter, error) {
+	if c.BatchSize < 1 {
+		return nil, ErrInvalidRemoteWriteBatchSize
+	}
+
+	if c.QueueSize < c.BatchSize {
+		return nil, ErrInvalidRemoteWriteQueueSize
+	}
+
+	if c.Interval <= 0 {
+		return nil, ErrInvalidRemoteWriteInterval
+	}
+
+	return &RemoteWriter{
+		Logger:   l,
+		Gatherer: g,
+		Storage:  st,
+		Config:   c,
+		client:   &http.Client{Timeout: remoteWriteTimeout},
+	}, nil
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func TestNewRemoteWriter(t *testing.T) {
+	tests := []struct {
+		batch    int
+		queue    int
+		interval time.Duration
+		err      error
+	}{
+		{500, 100000, time.Minute, nil},
+		{1, 1, time.Minute, nil},
+		{0, 100000, time.Minute, ErrInvalidRemoteWriteBatchSize},
+		{500, 499, time.Minute, ErrInvalidRemoteWriteQueueSize},
+		{500, 100000, 0, ErrInvalidRemoteWriteInterval},
+		{500, 100000, -time.Minute, ErrInvalidRemoteWriteInterval},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRemoteWriter(
+			log.Base(),
+			nil,
+			nil,
+			RemoteWriteConfig{
+				BatchSize: tt.batch,
+				QueueSize: tt.queue,
+				Interval:  tt.interval,
+			},
+		)
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("NewRemoteWriter(%d, %d, %v) error = %v, want %v", tt.batch, tt.queue, tt.interval, err, tt.err)
+		}
+	}
+}
+
+func segmentLines(t *testing.T, st *Storage) int {
+	t.Helper()
+
+	b, err := st.Read(remoteWriteName)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.Count(b, []byte("\n"))
+}
+
+func TestRemoteWriterSegment(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	defer srv.Close()
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "a"}))
+	r.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "b"}))
+
+	st, err := NewStorage(t.TempDir(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewRemoteWriter(
+		log.Base(),
+		r,
+		st,
+		RemoteWriteConfig{URL: srv.URL, BatchSize: 10, QueueSize: 100, Interval: time.Minute},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tick := func() {
+		t.Helper()
+
+		if err := w.gather(); err != nil {
+			t.Fatal(err)
+		}
+
+		n := w.removed()
+		w.flush()
+
+		if err := w.compact(w.removed() != n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Samples which are retried are only appended, never rewritten.
+	tick()
+	tick()
+
+	if n := segmentLines(t, st); n != 4 {
+		t.Errorf("segment = %d samples, want 4", n)
+	}
+
+	status = http.StatusNoContent
+	tick()
+
+	if n := segmentLines(t, st); n != 0 {
+		t.Errorf("segment = %d samples after sending, want 0", n)
+	}
+
+	if w.sent != 6 {
+		t.Errorf("sent = %d, want 6", w.sent)
+	}
+}
+
+func TestRemoteWriterRestore(t *testing.T) {
+	st, err := NewStorage(t.TempDir(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.Save(legacyRemoteWriteName, []remoteWriteSample{{Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last sample was torn by a crash.
+	b, err := encodeSegment([]remoteWriteSample{{Value: 2}, {Value: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.Write(remoteWriteName, append(b, `{"labels":[`...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewRemoteWriter(
+		log.Base(),
+		nil,
+		st,
+		RemoteWriteConfig{BatchSize: 10, QueueSize: 100, Interval: time.Minute},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.restore(); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	if len(w.queue) != 3 || w.queue[0].Value != 1 || w.queue[2].Value != 3 {
+		t.Errorf("queue = %+v, want values 1, 2 and 3", w.queue)
+	}
+
+	if n := segmentLines(t, st); n != 3 {
+		t.Errorf("segment = %d samples, want 3", n)
+	}
+
+	if _, err := os.Stat(filepath.Join(st.Path, legacyRemoteWriteName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("legacy queue wasn't removed")
+	}
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"time"
+)
+
+// StateChange is a change of the breaker or gas valve state. It's only part
+// of the snapshot of the telegram in which the change was observed.
+type StateChange struct {
+	Timestamp time.Time
+	Device    string
+	From      string
+	To        string
+}
+
+type Snapshot struct {
+	Timestamp                   time.Time
+	MeterTimestamp              time.Time
+	ReceivedTimestamp           time.Time
+	Version                     DSMRVersion
+	Header                      TelegramHeader
+	EquipmentIdentifier         string
+	GasEquipmentIdentifier      string
+	RawEquipmentIdentifier      string
+	RawGasEquipmentIdentifier   string
+	ElectricPowerDelivered      Power
+	TotalElectricityDelivered   map[int]Energy
+	ElectricPowerInjected       Power
+	TotalElectricityInjected    map[int]Energy
+	PhasePowerDelivered         map[string]Power
+	PhasePowerInjected          map[string]Power
+	ElectricCurrent             map[string]ElectricCurrent
+	Voltage                     map[string]Voltage
+	ElectricityTariffIndicator  int
+	BreakerState                BreakerState
+	BreakerStateObserved        bool
+	ElectricityLimiterThreshold Power
+	FuseThreshold               map[string]ElectricCurrent
+	TotalGasDeliveredTimestamp  time.Time
+	TotalGasDelivered           Volume
+	GasFlowRate                 VolumeFlowRate
+	GasValveState               GasValveState
+	GasValveStateObserved       bool
+	StateChanges                []StateChange
+	ElectricityDemand           Power
+	ElectricityDemandPeak       Power
+	ElectricityDemandPeakTime   time.Time
+	Periods                     map[string]PeriodTotals
+	Currency                    string
+	ElectricityCost             map[int]float64
+	ElectricityRevenue          map[int]float64
+	GasCost                     float64
+	Restored                    bool
+}
+
+func (s Snapshot) Up() bool {
+	return time.Since(s.Timestamp) <= upTimeout
+}
+
+func (s Snapshot) ElectricPowerNet() Power {
+	return s.ElectricPowerDelivered - s.ElectricPowerInjected
+}
+
+func (s Snapshot) TotalElectricityNet() Energy {
+	var e Energy
+	for _, v := range s.TotalElectricityDelivered {
+		e += v
+	}
+
+	for _, v := range s.TotalElectricityInjected {
+		e -= v
+	}
+
+	return e
+}
+
+func (s Snapshot) ApparentPower() map[string]ApparentPower {
+	p := make(map[string]ApparentPower)
+	for k, v := range s.Voltage {
+		if i, ok := s.ElectricCurrent[k]; ok {
+			p[k] = ApparentPower(float64(v) * float64(i))
+		}
+	}
+
+	return p
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	r := make(map[K]V, len(m))
+	for k, v := range m {
+		r[k] = v
+	}
+
+	return r
+}
@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"net"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+const (
+	speedwireInterval   = time.Second
+	speedwireProtocolID = 0x6069
+	speedwireSusyID     = 349
+	speedwireVersion    = 0x02001252
+)
+
+// OBIS channel types and indices of the EMETER protocol. Channels are
+// identified by their index, type and tariff, the latter is always zero.
+const (
+	speedwireActual  = 4
+	speedwireCounter = 8
+
+	speedwireActivePowerDelivered   = 1
+	speedwireActivePowerInjected    = 2
+	speedwireReactivePowerDelivered = 3
+	speedwireReactivePowerInjected  = 4
+	speedwireApparentPowerDelivered = 9
+	speedwireApparentPowerInjected  = 10
+	speedwirePowerFactor            = 13
+	speedwireCurrent                = 11
+	speedwireVoltage                = 12
+)
+
+// speedwirePhases maps phases onto the offset of their channel indices.
+var speedwirePhases = map[string]byte{
+	"l1": 20,
+	"l2": 40,
+	"l3": 60,
+}
+
+type SpeedwireConfig struct {
+	Address      string
+	SerialNumber uint32
+}
+
+// SpeedwireEmitter emulates an SMA Energy Meter by multicasting EMETER
+// datagrams, so SMA inverters can use the smart meter as their grid sensor.
+type SpeedwireEmitter struct {
+	Logger  log.Logger
+	P1State *P1State
+	Config  SpeedwireConfig
+
+	start time.Time
+}
+
+func (e *SpeedwireEmitter) Start() {
+	a, err := net.ResolveUDPAddr("udp4", e.Config.Address)
+	if err != nil {
+		e.Logger.Errorln(err)
+		return
+	}
+
+	c, err := net.DialUDP("udp4", nil, a)
+	if err != nil {
+		e.Logger.Errorln(err)
+		return
+	}
+
+	defer c.Close()
+
+	t := time.NewTicker(speedwireInterval)
+	defer t.Stop()
+
+	for range t.C {
+		// Stop sending while the meter is down, inverters then fall back to
+		// their own limits instead of acting on stale values.
+		s := e.P1State.Snapshot()
+		if !s.Up() {
+			continue
+		}
+
+		if _, err := c.Write(e.datagram(s)); err != nil {
+			e.Logger.Errorln(err)
+		}
+	}
+}
+
+func (e *SpeedwireEmitter) datagram(s Snapshot) []byte {
+	sn := e.Config.SerialNumber
+	if sn == 0 {
+		sn = crc32.ChecksumIEEE([]byte(s.EquipmentIdentifier))
+	}
+
+	var d []byte
+	d = binary.BigEndian.AppendUint16(d, speedwireProtocolID)
+	d = binary.BigEndian.AppendUint16(d, speedwireSusyID)
+	d = binary.BigEndian.AppendUint32(d, sn)
+	d = binary.BigEndian.AppendUint32(d, uint32(time.Since(e.start).Milliseconds()))
+
+	var delivered, injected Energy
+	for _, v := range s.TotalElectricityDelivered {
+		delivered += v
+	}
+
+	for _, v := range s.TotalElectricityInjected {
+		injected += v
+	}
+
+	var (
+		ap       = s.ApparentPower()
+		apparent ApparentPower
+	)
+
+	for _, v := range ap {
+		apparent += v
+	}
+
+	d = appendSpeedwireChannels(
+		d,
+		0,
+		s.ElectricPowerDelivered,
+		s.ElectricPowerInjected,
+		apparent,
+		delivered,
+		injected,
+	)
+
+	d = appendSpeedwireActual(
+		d,
+		speedwirePowerFactor,
+		powerFactor(s.ElectricPowerDelivered, s.ElectricPowerInjected, apparent)*1000,
+	)
+
+	for _, k := range sortedKeys(speedwirePhases) {
+		o := speedwirePhases[k]
+
+		// The meter only has energy counters for the totals.
+		d = appendSpeedwireChannels(
+			d,
+			o,
+			s.PhasePowerDelivered[k],
+			s.PhasePowerInjected[k],
+			ap[k],
+			0,
+			0,
+		)
+
+		d = appendSpeedwireActual(d, o+speedwireCurrent, float64(s.ElectricCurrent[k])*1000)
+		d = appendSpeedwireActual(d, o+speedwireVoltage, float64(s.Voltage[k])*1000)
+		d = appendSpeedwireActual(
+			d,
+			o+speedwirePowerFactor,
+			powerFactor(s.PhasePowerDelivered[k], s.PhasePowerInjected[k], ap[k])*1000,
+		)
+	}
+
+	d = binary.BigEndian.AppendUint32(d, 0x90000000)
+	d = binary.BigEndian.AppendUint32(d, speedwireVersion)
+
+	b := []byte("SMA\x00")
+	b = binary.BigEndian.AppendUint16(b, 4)
+	b = binary.BigEndian.AppendUint16(b, 0x02a0)
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(d)))
+	b = binary.BigEndian.AppendUint16(b, 0x0010)
+	b = append(b, d...)
+
+	return binary.BigEndian.AppendUint32(b, 0)
+}
+
+// appendSpeedwireChannels appends the active, reactive and apparent power
+// channels, in the order an SMA Energy Meter sends them. The meter doesn't
+// report the direction of apparent power, it follows the active power.
+func appendSpeedwireChannels(
+	d []byte,
+	o byte,
+	delivered, injected Power,
+	apparent ApparentPower,
+	energyDelivered, energyInjected Energy,
+) []byte {
+	var sd, si ApparentPower
+	if delivered >= injected {
+		sd = apparent
+	} else {
+		si = apparent
+	}
+
+	d = appendSpeedwireActual(d, o+speedwireActivePowerDelivered, float64(delivered)*10)
+	d = appendSpeedwireCounter(d, o+speedwireActivePowerDelivered, float64(energyDelivered))
+	d = appendSpeedwireActual(d, o+speedwireActivePowerInjected, float64(injected)*10)
+	d = appendSpeedwireCounter(d, o+speedwireActivePowerInjected, float64(energyInjected))
+	d = appendSpeedwireActual(d, o+speedwireReactivePowerDelivered, 0)
+	d = appendSpeedwireCounter(d, o+speedwireReactivePowerDelivered, 0)
+	d = appendSpeedwireActual(d, o+speedwireReactivePowerInjected, 0)
+	d = appendSpeedwireCounter(d, o+speedwireReactivePowerInjected, 0)
+	d = appendSpeedwireActual(d, o+speedwireApparentPowerDelivered, float64(sd)*10)
+	d = appendSpeedwireCounter(d, o+speedwireApparentPowerDelivered, 0)
+	d = appendSpeedwireActual(d, o+speedwireApparentPowerInjected, float64(si)*10)
+	return appendSpeedwireCounter(d, o+speedwireApparentPowerInjected, 0)
+}
+
+func powerFactor(delivered, injected Power, apparent ApparentPower) float64 {
+	if apparent <= 0 {
+		return 1
+	}
+
+	return math.Min(math.Abs(float64(delivered-injected))/float64(apparent), 1)
+}
+
+func appendSpeedwireActual(d []byte, i byte, v float64) []byte {
+	d = append(d, 0, i, speedwireActual, 0)
+	return binary.BigEndian.AppendUint32(d, uint32(math.Round(v)))
+}
+
+// appendSpeedwireCounter appends an energy counter in watt-seconds.
+func appendSpeedwireCounter(d []byte, i byte, v float64) []byte {
+	d = append(d, 0, i, speedwireCounter, 0)
+	return binary.BigEndian.AppendUint64(d, uint64(math.Round(v*3600)))
+}
+
+func NewSpeedwireEmitter(l log.Logger, s *P1State, c SpeedwireConfig) *SpeedwireEmitter {
+	return &SpeedwireEmitter{
+		Logger:  l,
+		P1State: s,
+		Config:  c,
+		start:   time.Now(),
+	}
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+// speedwireChannels returns the values in a datagram by OBIS channel, keyed
+// by index and type.
+func speedwireChannels(t *testing.T, d []byte) map[[2]byte]uint64 {
+	t.Helper()
+
+	c := make(map[[2]byte]uint64)
+	for len(d) >= 4 {
+		if binary.BigEndian.Uint32(d) == 0x90000000 {
+			return c
+		}
+
+		k := [2]byte{d[1], d[2]}
+		switch d[2] {
+		case speedwireActual:
+			c[k] = uint64(binary.BigEndian.Uint32(d[4:]))
+			d = d[8:]
+		case speedwireCounter:
+			c[k] = binary.BigEndian.Uint64(d[4:])
+			d = d[12:]
+		default:
+			t.Fatalf("unknown channel type %d", d[2])
+		}
+	}
+
+	t.Fatal("missing version channel")
+	return nil
+}
+
+func TestSpeedwireDatagram(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	err := s.handleTelegram(ParseTelegram(
+		"/KFM5KAIFA-METER\r\n" +
+			"\r\n" +
+			"1-3:0.2.8(50)\r\n" +
+			"0-0:1.0.0(210204163628W)\r\n" +
+			"1-0:1.8.1(000123.456*kWh)\r\n" +
+			"1-0:2.8.1(000010.000*kWh)\r\n" +
+			"1-0:1.7.0(00.700*kW)\r\n" +
+			"1-0:2.7.0(00.000*kW)\r\n" +
+			"1-0:21.7.0(00.700*kW)\r\n" +
+			"1-0:32.7.0(230.1*V)\r\n" +
+			"1-0:31.7.0(003*A)\r\n" +
+			"!1234\r\n",
+	))
+
+	if err != nil {
+		t.Fatalf("handleTelegram() error = %v", err)
+	}
+
+	e := NewSpeedwireEmitter(log.Base(), s, SpeedwireConfig{SerialNumber: 1234567890})
+	b := e.datagram(s.Snapshot())
+
+	if !bytes.HasPrefix(b, []byte("SMA\x00\x00\x04\x02\xa0\x00\x00\x00\x01")) {
+		t.Fatalf("header = % x", b[:12])
+	}
+
+	// The length covers the data from the protocol ID up to the end marker.
+	if n := int(binary.BigEndian.Uint16(b[12:])); n != len(b)-20 {
+		t.Errorf("length = %d, want %d", n, len(b)-20)
+	}
+
+	if v := binary.BigEndian.Uint16(b[14:]); v != 0x0010 {
+		t.Errorf("tag = %#x, want 0x10", v)
+	}
+
+	if v := binary.BigEndian.Uint16(b[16:]); v != speedwireProtocolID {
+		t.Errorf("protocol ID = %#x, want %#x", v, speedwireProtocolID)
+	}
+
+	if v := binary.BigEndian.Uint32(b[20:]); v != 1234567890 {
+		t.Errorf("serial number = %d, want 1234567890", v)
+	}
+
+	if v := binary.BigEndian.Uint32(b[len(b)-4:]); v != 0 {
+		t.Errorf("end marker = %#x, want 0", v)
+	}
+
+	c := speedwireChannels(t, b[28:len(b)-4])
+
+	// Power is sent in 0.1 W, energy in Ws, current in mA and voltage in mV.
+	tests := []struct {
+		name    string
+		channel [2]byte
+		want    uint64
+	}{
+		{"power delivered", [2]byte{1, speedwireActual}, 7000},
+		{"energy delivered", [2]byte{1, speedwireCounter}, 123456 * 3600},
+		{"power injected", [2]byte{2, speedwireActual}, 0},
+		{"energy injected", [2]byte{2, speedwireCounter}, 10000 * 3600},
+		{"apparent power delivered", [2]byte{9, speedwireActual}, 6903},
+		{"power factor", [2]byte{13, speedwireActual}, 1000},
+		{"l1 power delivered", [2]byte{21, speedwireActual}, 7000},
+		{"l1 current", [2]byte{31, speedwireActual}, 3000},
+		{"l1 voltage", [2]byte{32, speedwireActual}, 230100},
+		{"l2 power delivered", [2]byte{41, speedwireActual}, 0},
+	}
+
+	for _, tt := range tests {
+		v, ok := c[tt.channel]
+		if !ok {
+			t.Errorf("%s: channel %d:%d missing", tt.name, tt.channel[0], tt.channel[1])
+			continue
+		}
+
+		if v != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, v, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+const splitterWriteTimeout = 10 * time.Second
+
+// Splitter forwards every raw telegram to any number of TCP clients, like
+// ser2net does for the serial port, so other consumers of the P1 port can
+// share the meter with the exporter.
+type Splitter struct {
+	Logger       log.Logger
+	P1State      *P1State
+	WriteTimeout time.Duration
+}
+
+func (s *Splitter) Serve(l net.Listener) error {
+	return accept(s.Logger, l, s.serve)
+}
+
+func (s *Splitter) serve(c net.Conn) {
+	defer c.Close()
+
+	s.Logger.Infoln("splitter client connected from", c.RemoteAddr())
+	defer s.Logger.Infoln("splitter client disconnected from", c.RemoteAddr())
+
+	ch := s.P1State.SubscribeTelegrams()
+	defer s.P1State.UnsubscribeTelegrams(ch)
+
+	// Clients aren't expected to send anything, but reading is the only way
+	// to notice they disconnected while the meter is idle.
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, c)
+		close(done)
+	}()
+
+	for {
+		select {
+		case t := <-ch:
+			// Clients which can't keep up are dropped, until then they only
+			// receive the most recent telegram.
+			if err := c.SetWriteDeadline(time.Now().Add(s.WriteTimeout)); err != nil {
+				return
+			}
+
+			if _, err := io.WriteString(c, t.Raw); err != nil {
+				return
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+func NewSplitter(l log.Logger, s *P1State) *Splitter {
+	return &Splitter{
+		Logger:       l,
+		P1State:      s,
+		WriteTimeout: splitterWriteTimeout,
+	}
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestSplitterFanOut(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+	go NewSplitter(log.Base(), s).Serve(l)
+
+	var cs []*bufio.Reader
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer c.Close()
+		if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		cs = append(cs, bufio.NewReader(c))
+	}
+
+	waitSubscribers(t, &s.telegrams, 2)
+
+	raw := "/KFM5KAIFA-METER\r\n\r\n1-0:1.8.1(000123.456*kWh)\r\n!1234\r\n"
+	s.telegrams.Publish(ParseTelegram(raw))
+
+	for i, r := range cs {
+		b := make([]byte, len(raw))
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatalf("client %d: ReadFull() error = %v", i, err)
+		}
+
+		if string(b) != raw {
+			t.Errorf("client %d received %q, want %q", i, b, raw)
+		}
+	}
+}
+
+func TestSplitterSlowClient(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	sp := NewSplitter(log.Base(), s)
+	sp.WriteTimeout = 10 * time.Millisecond
+
+	// Writes to a pipe block until the client reads, which this one never
+	// does.
+	c, client := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		sp.serve(c)
+		close(done)
+	}()
+
+	waitSubscribers(t, &s.telegrams, 1)
+	s.telegrams.Publish(ParseTelegram("/KFM5KAIFA-METER\r\n\r\n!1234\r\n"))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow client wasn't dropped")
+	}
+
+	waitSubscribers(t, &s.telegrams, 0)
+}
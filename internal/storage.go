@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrInvalidStorageInterval = errors.New("invalid storage interval")
+
+type Storage struct {
+	Path     string
+	Interval time.Duration
+}
+
+func (s *Storage) Load(name string, v interface{}) error {
+	b, err := s.Read(name)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func (s *Storage) Save(name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.Write(name, b)
+}
+
+func (s *Storage) Read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Path, name))
+}
+
+// Write replaces the file atomically, a crash leaves either the old or the
+// new contents behind.
+func (s *Storage) Write(name string, b []byte) error {
+	f, err := os.CreateTemp(s.Path, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(s.Path, name))
+}
+
+func (s *Storage) Append(name string, b []byte) error {
+	f, err := os.OpenFile(
+		filepath.Join(s.Path, name),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0o640,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *Storage) Remove(name string) error {
+	err := os.Remove(filepath.Join(s.Path, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func NewStorage(p string, i time.Duration) (*Storage, error) {
+	if i <= 0 {
+		return nil, ErrInvalidStorageInterval
+	}
+
+	if err := os.MkdirAll(p, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		Path:     p,
+		Interval: i,
+	}, nil
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewStorage(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		err      error
+	}{
+		{time.Minute, nil},
+		{0, ErrInvalidStorageInterval},
+		{-time.Minute, ErrInvalidStorageInterval},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewStorage(t.TempDir(), tt.interval); !errors.Is(err, tt.err) {
+			t.Errorf("NewStorage(%v) error = %v, want %v", tt.interval, err, tt.err)
+		}
+	}
+}
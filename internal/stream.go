@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamKeepAliveInterval = 15 * time.Second
+	streamWriteTimeout      = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// ServeStream pushes a snapshot for every telegram, either as server-sent
+// events or over a WebSocket if the client requests an upgrade.
+func (a *API) ServeStream(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		a.serveWebSocket(w, r)
+		return
+	}
+
+	a.serveEvents(w, r)
+}
+
+func (a *API) serveEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c := a.P1State.Subscribe()
+	defer a.P1State.Unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	t := time.NewTicker(streamKeepAliveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-t.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+		case s := <-c:
+			v := newSnapshotResponse(s, a.TariffNames)
+
+			// State changes are sent as events of their own as well, so
+			// that clients can listen for them alone.
+			for _, e := range v.StateChanges {
+				if err := writeEvent(w, "state_change", e); err != nil {
+					return
+				}
+			}
+
+			if err := writeEvent(w, "snapshot", v); err != nil {
+				return
+			}
+		}
+
+		f.Flush()
+	}
+}
+
+func (a *API) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	c := a.P1State.Subscribe()
+	defer a.P1State.Unsubscribe(c)
+
+	// Messages from the client are discarded, but reading is required to
+	// process control frames and notice when the connection is closed.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	t := time.NewTicker(streamKeepAliveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-t.C:
+			err := conn.WriteControl(
+				websocket.PingMessage,
+				nil,
+				time.Now().Add(streamWriteTimeout),
+			)
+
+			if err != nil {
+				return
+			}
+
+		case s := <-c:
+			if err := conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+
+			if err := conn.WriteJSON(newSnapshotResponse(s, a.TariffNames)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
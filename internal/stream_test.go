@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/common/log"
+)
+
+func TestAPIServeStream(t *testing.T) {
+	s := NewP1State(log.Base(), nil, nil, nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(NewAPI(s, nil).ServeStream))
+	defer srv.Close()
+
+	publish := func(t *testing.T) {
+		t.Helper()
+
+		waitSubscribers(t, &s.snapshots, 1)
+		if err := s.handleTelegram(ParseTelegram(testTelegram)); err != nil {
+			t.Fatalf("handleTelegram() error = %v", err)
+		}
+	}
+
+	t.Run("events", func(t *testing.T) {
+		r, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer r.Body.Close()
+
+		if v := r.Header.Get("Content-Type"); v != "text/event-stream" {
+			t.Errorf("Content-Type = %q, want %q", v, "text/event-stream")
+		}
+
+		publish(t)
+
+		sc := bufio.NewScanner(r.Body)
+		if !sc.Scan() || sc.Text() != "event: snapshot" {
+			t.Fatalf("event = %q, want %q", sc.Text(), "event: snapshot")
+		}
+
+		if !sc.Scan() || !strings.HasPrefix(sc.Text(), "data: ") {
+			t.Fatalf("data = %q", sc.Text())
+		}
+
+		var v snapshotResponse
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(sc.Text(), "data: ")), &v); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		if v.Meter.EquipmentIdentifier != "KFM001" {
+			t.Errorf("EquipmentIdentifier = %q, want %q", v.Meter.EquipmentIdentifier, "KFM001")
+		}
+	})
+
+	// The subscription ends with the request.
+	waitSubscribers(t, &s.snapshots, 0)
+
+	t.Run("websocket", func(t *testing.T) {
+		c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer c.Close()
+
+		publish(t)
+
+		if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		var v snapshotResponse
+		if err := c.ReadJSON(&v); err != nil {
+			t.Fatalf("ReadJSON() error = %v", err)
+		}
+
+		if v.Meter.EquipmentIdentifier != "KFM001" {
+			t.Errorf("EquipmentIdentifier = %q, want %q", v.Meter.EquipmentIdentifier, "KFM001")
+		}
+	})
+
+	waitSubscribers(t, &s.snapshots, 0)
+}
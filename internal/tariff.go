@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidTariffNames = errors.New("invalid tariff names")
+
+type TariffNames map[int]string
+
+func (n TariffNames) Name(t int) string {
+	if v, ok := n[t]; ok {
+		return v
+	}
+
+	return strconv.Itoa(t)
+}
+
+func (n TariffNames) Tariffs(m ...map[int]Energy) []int {
+	r := make(map[int]struct{})
+	for k := range n {
+		r[k] = struct{}{}
+	}
+
+	for _, v := range m {
+		for k := range v {
+			r[k] = struct{}{}
+		}
+	}
+
+	t := make([]int, 0, len(r))
+	for k := range r {
+		t = append(t, k)
+	}
+
+	sort.Ints(t)
+	return t
+}
+
+// ParseTariffNames parses a list of tariff:name pairs. Every tariff and
+// every name may only appear once, otherwise tariffs would share a label.
+func ParseTariffNames(s string) (TariffNames, error) {
+	n := make(TariffNames)
+	if s == "" {
+		return n, nil
+	}
+
+	names := make(map[string]struct{})
+	for _, v := range strings.Split(s, ",") {
+		k, name, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, ErrInvalidTariffNames
+		}
+
+		t, err := strconv.Atoi(strings.TrimSpace(k))
+		if err != nil {
+			return nil, err
+		}
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, ErrInvalidTariffNames
+		}
+
+		if _, ok := n[t]; ok {
+			return nil, ErrInvalidTariffNames
+		}
+
+		if _, ok := names[name]; ok {
+			return nil, ErrInvalidTariffNames
+		}
+
+		n[t] = name
+		names[name] = struct{}{}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseTariffNames(t *testing.T) {
+	tests := []struct {
+		in    string
+		names TariffNames
+		err   error
+	}{
+		{"", TariffNames{}, nil},
+		{"1:peak,2:offpeak", TariffNames{1: "peak", 2: "offpeak"}, nil},
+		{" 1 : peak , 2 : offpeak ", TariffNames{1: "peak", 2: "offpeak"}, nil},
+		{"1:peak,2:peak", nil, ErrInvalidTariffNames},
+		{"1:peak,1:offpeak", nil, ErrInvalidTariffNames},
+		{"1:", nil, ErrInvalidTariffNames},
+		{"1: ", nil, ErrInvalidTariffNames},
+		{"peak", nil, ErrInvalidTariffNames},
+		{"x:peak", nil, strconv.ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		n, err := ParseTariffNames(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseTariffNames(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+
+		if !reflect.DeepEqual(n, tt.names) {
+			t.Errorf("ParseTariffNames(%q) = %v, want %v", tt.in, n, tt.names)
+		}
+	}
+}
+
+func TestTariffNamesName(t *testing.T) {
+	n := TariffNames{1: "peak"}
+
+	tests := []struct {
+		tariff int
+		name   string
+	}{
+		{1, "peak"},
+		{2, "2"},
+	}
+
+	for _, tt := range tests {
+		if v := n.Name(tt.tariff); v != tt.name {
+			t.Errorf("Name(%d) = %q, want %q", tt.tariff, v, tt.name)
+		}
+	}
+}
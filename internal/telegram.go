@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/skoef/gop1"
+)
+
+var (
+	telegramHeaderRegex = regexp.MustCompile(`^/(.+)$`)
+	cosemOBISRegex      = regexp.MustCompile(`^(\d+-\d+:\d+\.\d+\.\d+)([0-9A-Za-z()*\-.:]+)$`)
+	cosemValuesRegex    = regexp.MustCompile(`\(([^)]+)\)`)
+	cosemUnitRegex      = regexp.MustCompile(`^([\d.]+)\*(?i)([a-z0-9]+)$`)
+)
+
+var (
+	obisTypes = map[string]gop1.OBISType{
+		"1-3:0.2.8":   gop1.OBISTypeVersionInformation,
+		"0-0:96.1.4":  gop1.OBISTypeVersionInformation,
+		"0-0:1.0.0":   gop1.OBISTypeDateTimestamp,
+		"0-0:96.1.1":  gop1.OBISTypeEquipmentIdentifier,
+		"1-0:1.8.1":   gop1.OBISTypeElectricityDeliveredTariff1,
+		"1-0:1.8.2":   gop1.OBISTypeElectricityDeliveredTariff2,
+		"1-0:2.8.1":   gop1.OBISTypeElectricityGeneratedTariff1,
+		"1-0:2.8.2":   gop1.OBISTypeElectricityGeneratedTariff2,
+		"0-0:96.14.0": gop1.OBISTypeElectricityTariffIndicator,
+		"1-0:1.7.0":   gop1.OBISTypeElectricityDelivered,
+		"1-0:2.7.0":   gop1.OBISTypeElectricityGenerated,
+		"0-0:96.7.21": gop1.OBISTypeNumberOfPowerFailures,
+		"0-0:96.7.9":  gop1.OBISTypeNumberOfLongPowerFailures,
+		"1-0:99.97.0": gop1.OBISTypePowerFailureEventLog,
+		"1-0:32.32.0": gop1.OBISTypeNumberOfVoltageSagsL1,
+		"1-0:52.32.0": gop1.OBISTypeNumberOfVoltageSagsL2,
+		"1-0:72.32.0": gop1.OBISTypeNumberOfVoltageSagsL3,
+		"1-0:32.36.0": gop1.OBISTypeNumberOfVoltageSwellsL1,
+		"1-0:52.36.0": gop1.OBISTypeNumberOfVoltageSwellsL2,
+		"1-0:72.36.0": gop1.OBISTypeNumberOfVoltageSwellsL3,
+		"0-0:96.13.0": gop1.OBISTypeTextMessage,
+		"0-0:96.13.1": gop1.OBISTypeConsumerMessageCode,
+		"1-0:32.7.0":  gop1.OBISTypeInstantaneousVoltageL1,
+		"1-0:52.7.0":  gop1.OBISTypeInstantaneousVoltageL2,
+		"1-0:72.7.0":  gop1.OBISTypeInstantaneousVoltageL3,
+		"1-0:31.7.0":  gop1.OBISTypeInstantaneousCurrentL1,
+		"1-0:51.7.0":  gop1.OBISTypeInstantaneousCurrentL2,
+		"1-0:71.7.0":  gop1.OBISTypeInstantaneousCurrentL3,
+		"1-0:21.7.0":  gop1.OBISTypeInstantaneousPowerDeliveredL1,
+		"1-0:41.7.0":  gop1.OBISTypeInstantaneousPowerDeliveredL2,
+		"1-0:61.7.0":  gop1.OBISTypeInstantaneousPowerDeliveredL3,
+		"1-0:22.7.0":  gop1.OBISTypeInstantaneousPowerGeneratedL1,
+		"1-0:42.7.0":  gop1.OBISTypeInstantaneousPowerGeneratedL2,
+		"1-0:62.7.0":  gop1.OBISTypeInstantaneousPowerGeneratedL3,
+		"0-0:96.3.10": gop1.OBISTypeBreakerState,
+		"0-0:17.0.0":  gop1.OBISTypeLimiterThreshold,
+		"1-0:31.4.0":  gop1.OBISTypeFuseThresholdL1,
+	}
+
+	// M-Bus devices such as gas meters use the channel number as the second
+	// group of their OBIS code.
+	mbusOBISTypes = map[*regexp.Regexp]gop1.OBISType{
+		regexp.MustCompile(`^0-\d+:96\.1\.0$`): gop1.OBISTypeGasEquipmentIdentifier,
+		regexp.MustCompile(`^0-\d+:96\.1\.1$`): gop1.OBISTypeGasEquipmentIdentifier,
+		regexp.MustCompile(`^0-\d+:24\.1\.0$`): gop1.OBISTypeDeviceType,
+		regexp.MustCompile(`^0-\d+:24\.2\.1$`): gop1.OBISTypeGasDelivered,
+		regexp.MustCompile(`^0-\d+:24\.2\.3$`): gop1.OBISTypeGasDelivered,
+		regexp.MustCompile(`^0-\d+:24\.4\.0$`): gop1.OBISTypeGasValveState,
+	}
+)
+
+// Telegram is a parsed telegram which retains the raw text it was parsed
+// from, so that it can be passed on to other consumers.
+type Telegram struct {
+	gop1.Telegram
+	Raw   string
+	Lines []TelegramLine
+}
+
+// TelegramLine is a line of a telegram along with its OBIS code, if any, and
+// the object it was parsed into, if its code is known. Once the telegram has
+// been handled, it also holds how the object was interpreted or why it
+// couldn't be.
+type TelegramLine struct {
+	Text           string
+	Code           string
+	Object         *gop1.TelegramObject
+	Interpretation string
+	Error          error
+}
+
+func ParseTelegram(raw string) *Telegram {
+	t := &Telegram{
+		Raw: raw,
+	}
+
+	for _, l := range strings.Split(raw, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		if m := telegramHeaderRegex.FindStringSubmatch(l); m != nil {
+			t.Device = m[1]
+			t.Lines = append(t.Lines, TelegramLine{Text: l})
+			continue
+		}
+
+		c, o, err := parseTelegramLine(l)
+		if o != nil {
+			t.Objects = append(t.Objects, o)
+		}
+
+		t.Lines = append(t.Lines, TelegramLine{Text: l, Code: c, Object: o, Error: err})
+	}
+
+	return t
+}
+
+// parseTelegramLine returns the OBIS code of a line, along with its object if
+// the code is known. Known codes without any values are invalid.
+func parseTelegramLine(l string) (string, *gop1.TelegramObject, error) {
+	m := cosemOBISRegex.FindStringSubmatch(l)
+	if m == nil {
+		return "", nil, nil
+	}
+
+	o := &gop1.TelegramObject{
+		Type: lookupOBISType(m[1]),
+	}
+
+	if o.Type == "" {
+		return m[1], nil, nil
+	}
+
+	vs := cosemValuesRegex.FindAllStringSubmatch(m[2], -1)
+	if len(vs) == 0 {
+		return m[1], nil, ErrInvalidTelegramValue
+	}
+
+	for _, v := range vs {
+		if u := cosemUnitRegex.FindStringSubmatch(v[1]); u != nil {
+			o.Values = append(o.Values, gop1.TelegramValue{Value: u[1], Unit: u[2]})
+		} else {
+			o.Values = append(o.Values, gop1.TelegramValue{Value: v[1]})
+		}
+	}
+
+	return m[1], o, nil
+}
+
+func lookupOBISType(c string) gop1.OBISType {
+	if t, ok := obisTypes[c]; ok {
+		return t
+	}
+
+	for r, t := range mbusOBISTypes {
+		if r.MatchString(c) {
+			return t
+		}
+	}
+
+	return ""
+}
+
+func interpretValue(name string, v interface{}) string {
+	return fmt.Sprintf("%s: %v", name, v)
+}
+
+func interpretQuantity[T ~float64](name string, v T, unit string) string {
+	return fmt.Sprintf(
+		"%s: %s %s",
+		name,
+		strconv.FormatFloat(float64(v), 'f', -1, 64),
+		unit,
+	)
+}
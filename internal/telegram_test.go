@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/skoef/gop1"
+)
+
+func TestParseTelegramLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		code   string
+		object *gop1.TelegramObject
+		err    error
+	}{
+		{
+			line: "1-0:1.8.1(000123.456*kWh)",
+			code: "1-0:1.8.1",
+			object: &gop1.TelegramObject{
+				Type:   gop1.OBISTypeElectricityDeliveredTariff1,
+				Values: []gop1.TelegramValue{{Value: "000123.456", Unit: "kWh"}},
+			},
+		},
+		{
+			line: "0-1:24.2.3(210204163500W)(00012.345*m3)",
+			code: "0-1:24.2.3",
+			object: &gop1.TelegramObject{
+				Type: gop1.OBISTypeGasDelivered,
+				Values: []gop1.TelegramValue{
+					{Value: "210204163500W"},
+					{Value: "00012.345", Unit: "m3"},
+				},
+			},
+		},
+		{
+			line: "0-2:96.1.0(4B464D303031)",
+			code: "0-2:96.1.0",
+			object: &gop1.TelegramObject{
+				Type:   gop1.OBISTypeGasEquipmentIdentifier,
+				Values: []gop1.TelegramValue{{Value: "4B464D303031"}},
+			},
+		},
+		{
+			line: "0-0:96.1.4(50217)",
+			code: "0-0:96.1.4",
+			object: &gop1.TelegramObject{
+				Type:   gop1.OBISTypeVersionInformation,
+				Values: []gop1.TelegramValue{{Value: "50217"}},
+			},
+		},
+		{line: "1-0:1.4.0(00.123*kW)", code: "1-0:1.4.0"},
+		{line: "1-0:1.8.1()", code: "1-0:1.8.1", err: ErrInvalidTelegramValue},
+		{line: "!1234"},
+		{line: "/KFM5KAIFA-METER"},
+	}
+
+	for _, tt := range tests {
+		c, o, err := parseTelegramLine(tt.line)
+		if c != tt.code || !reflect.DeepEqual(o, tt.object) || !errors.Is(err, tt.err) {
+			t.Errorf(
+				"parseTelegramLine(%q) = %q, %+v, %v, want %q, %+v, %v",
+				tt.line, c, o, err, tt.code, tt.object, tt.err,
+			)
+		}
+	}
+}
+
+func TestParseTelegram(t *testing.T) {
+	v := ParseTelegram(
+		"/KFM5KAIFA-METER\r\n" +
+			"\r\n" +
+			"1-3:0.2.8(42)\r\n" +
+			"1-0:1.4.0(00.123*kW)\r\n" +
+			"1-0:1.8.1()\r\n" +
+			"1-0:1.8.2(000456.789*kWh)\r\n" +
+			"!1234\r\n",
+	)
+
+	if v.Device != "KFM5KAIFA-METER" {
+		t.Errorf("Device = %q, want %q", v.Device, "KFM5KAIFA-METER")
+	}
+
+	if len(v.Objects) != 2 {
+		t.Errorf("Objects = %d, want 2", len(v.Objects))
+	}
+
+	want := []TelegramLine{
+		{Text: "/KFM5KAIFA-METER"},
+		{Text: "1-3:0.2.8(42)", Code: "1-3:0.2.8", Object: v.Objects[0]},
+		{Text: "1-0:1.4.0(00.123*kW)", Code: "1-0:1.4.0"},
+		{Text: "1-0:1.8.1()", Code: "1-0:1.8.1", Error: ErrInvalidTelegramValue},
+		{Text: "1-0:1.8.2(000456.789*kWh)", Code: "1-0:1.8.2", Object: v.Objects[1]},
+		{Text: "!1234"},
+	}
+
+	if !reflect.DeepEqual(v.Lines, want) {
+		t.Errorf("Lines = %+v, want %+v", v.Lines, want)
+	}
+}
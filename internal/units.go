@@ -7,6 +7,8 @@ import (
 	"github.com/skoef/gop1"
 )
 
+type ApparentPower float64
+
 type ElectricCurrent float64
 
 func ParseElectricCurrent(v gop1.TelegramValue) (ElectricCurrent, error) {
@@ -81,3 +83,5 @@ func ParseVolume(v gop1.TelegramValue) (Volume, error) {
 
 	return Volume(u), nil
 }
+
+type VolumeFlowRate float64
@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -9,19 +11,46 @@ import (
 )
 
 var (
+	ErrInvalidTelegramHeader  = errors.New("invalid telegram header")
+	ErrInvalidTelegramValue   = errors.New("invalid telegram value")
+	ErrMissingTelegramValue   = errors.New("missing telegram value")
 	ErrInvalidTimestampSeason = errors.New("invalid timestamp season")
 	ErrUnknownBreakerState    = errors.New("unknown breaker state")
 	ErrUnknownGasValveState   = errors.New("unknown gas valve state")
 )
 
+var (
+	cet  = time.FixedZone("CET", 60*60)
+	cest = time.FixedZone("CEST", 2*60*60)
+)
+
 type BreakerState int
 
 const (
-	BreakerStateDisconnected         = 0
-	BreakerStateConnected            = 1
-	BreakerStateReadyForReconnection = 2
+	BreakerStateDisconnected         BreakerState = 0
+	BreakerStateConnected            BreakerState = 1
+	BreakerStateReadyForReconnection BreakerState = 2
 )
 
+var BreakerStates = []BreakerState{
+	BreakerStateDisconnected,
+	BreakerStateConnected,
+	BreakerStateReadyForReconnection,
+}
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerStateDisconnected:
+		return "disconnected"
+	case BreakerStateConnected:
+		return "connected"
+	case BreakerStateReadyForReconnection:
+		return "ready_for_reconnection"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
+
 func ParseBreakerState(v gop1.TelegramValue) (BreakerState, error) {
 	u, err := strconv.Atoi(v.Value)
 	if err != nil {
@@ -43,11 +72,30 @@ func ParseBreakerState(v gop1.TelegramValue) (BreakerState, error) {
 type GasValveState int
 
 const (
-	GasValveStateDisconnected         = 0
-	GasValveStateConnected            = 1
-	GasValveStateReadyForReconnection = 2
+	GasValveStateDisconnected         GasValveState = 0
+	GasValveStateConnected            GasValveState = 1
+	GasValveStateReadyForReconnection GasValveState = 2
 )
 
+var GasValveStates = []GasValveState{
+	GasValveStateDisconnected,
+	GasValveStateConnected,
+	GasValveStateReadyForReconnection,
+}
+
+func (s GasValveState) String() string {
+	switch s {
+	case GasValveStateDisconnected:
+		return "disconnected"
+	case GasValveStateConnected:
+		return "connected"
+	case GasValveStateReadyForReconnection:
+		return "ready_for_reconnection"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
+
 func ParseGasValveState(v gop1.TelegramValue) (GasValveState, error) {
 	u, err := strconv.Atoi(v.Value)
 	if err != nil {
@@ -66,22 +114,71 @@ func ParseGasValveState(v gop1.TelegramValue) (GasValveState, error) {
 	}
 }
 
+// DSMRVersion is the version reported by the meter. e-MUCS meters report it
+// in 0-0:96.1.4 with the version of their companion specification appended,
+// e.g. 50217 for DSMR 5.0.2 and e-MUCS 1.7.
+type DSMRVersion int
+
+// Major returns the DSMR version without the appended digits, e.g. 50 for
+// 50217.
+func (v DSMRVersion) Major() DSMRVersion {
+	for v > 99 {
+		v /= 10
+	}
+
+	return v
+}
+
+func (v DSMRVersion) String() string {
+	v = v.Major()
+	return fmt.Sprintf("%d.%d", v/10, v%10)
+}
+
+func ParseDSMRVersion(v gop1.TelegramValue) (DSMRVersion, error) {
+	u, err := strconv.Atoi(v.Value)
+	if err != nil {
+		return 0, err
+	}
+
+	return DSMRVersion(u), nil
+}
+
+func ParseEquipmentIdentifier(v gop1.TelegramValue) string {
+	u, err := hex.DecodeString(v.Value)
+	if err != nil {
+		return v.Value
+	}
+
+	for _, c := range u {
+		if c < 0x20 || c > 0x7e {
+			return v.Value
+		}
+	}
+
+	return string(u)
+}
+
 func ParseElectricityTariffIndicator(v gop1.TelegramValue) (int, error) {
 	return strconv.Atoi(v.Value)
 }
 
 func ParseTimestamp(v gop1.TelegramValue) (time.Time, error) {
+	if v.Value == "" {
+		return time.Time{}, ErrInvalidTimestampSeason
+	}
+
 	t := v.Value[:len(v.Value)-1]
 	s := v.Value[len(v.Value)-1:]
 
+	var l *time.Location
 	switch s {
 	case "S":
-		t += "CEST"
+		l = cest
 	case "W":
-		t += "CET"
+		l = cet
 	default:
 		return time.Time{}, ErrInvalidTimestampSeason
 	}
 
-	return time.Parse("060102150405MST", t)
+	return time.ParseInLocation("060102150405", t, l)
 }
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skoef/gop1"
+)
+
+func TestDSMRVersionString(t *testing.T) {
+	tests := []struct {
+		version DSMRVersion
+		want    string
+	}{
+		{42, "4.2"},
+		{50, "5.0"},
+		{502, "5.0"},
+		{50217, "5.0"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.version.String(); got != tt.want {
+			t.Errorf("DSMRVersion(%d).String() = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseDSMRVersion(t *testing.T) {
+	tests := []struct {
+		value string
+		want  DSMRVersion
+	}{
+		{"42", 42},
+		{"50", 50},
+		{"50217", 50217},
+	}
+
+	for _, tt := range tests {
+		v, err := ParseDSMRVersion(gop1.TelegramValue{Value: tt.value})
+		if err != nil {
+			t.Errorf("ParseDSMRVersion(%q) error = %v", tt.value, err)
+			continue
+		}
+
+		if v != tt.want {
+			t.Errorf("ParseDSMRVersion(%q) = %d, want %d", tt.value, v, tt.want)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		err   error
+	}{
+		{"240115120000W", time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC), nil},
+		{"240715120000S", time.Date(2024, 7, 15, 10, 0, 0, 0, time.UTC), nil},
+		{"241027020000S", time.Date(2024, 10, 27, 0, 0, 0, 0, time.UTC), nil},
+		{"241027020000W", time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC), nil},
+		{"240115120000", time.Time{}, ErrInvalidTimestampSeason},
+		{"", time.Time{}, ErrInvalidTimestampSeason},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTimestamp(gop1.TelegramValue{Value: tt.value})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseTimestamp(%q) error = %v, want %v", tt.value, err, tt.err)
+			continue
+		}
+
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTimestamp(%q) = %v, want %v", tt.value, got.UTC(), tt.want)
+		}
+	}
+}
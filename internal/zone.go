@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"time"
+)
+
+// meterZone returns the zone the meter uses at t. Meters follow the European
+// summer time rules, switching at 01:00 UTC on the last Sundays of March and
+// October.
+func meterZone(t time.Time) *time.Location {
+	y := t.UTC().Year()
+	if !t.Before(lastSunday(y, time.March)) && t.Before(lastSunday(y, time.October)) {
+		return cest
+	}
+
+	return cet
+}
+
+// meterTime returns t in the meter's zone.
+func meterTime(t time.Time) time.Time {
+	return t.In(meterZone(t))
+}
+
+// meterDate returns the start of the given day in the meter's zone, which
+// never falls within a transition.
+func meterDate(y int, m time.Month, d int) time.Time {
+	t := time.Date(y, m, d, 0, 0, 0, 0, cet)
+	if meterZone(t) == cest {
+		t = time.Date(y, m, d, 0, 0, 0, 0, cest)
+	}
+
+	return meterTime(t)
+}
+
+func lastSunday(y int, m time.Month) time.Time {
+	t := time.Date(y, m+1, 0, 1, 0, 0, 0, time.UTC)
+	return t.AddDate(0, 0, -int(t.Weekday()))
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeterZone(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want *time.Location
+	}{
+		{time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), cet},
+		{time.Date(2024, 3, 31, 0, 59, 59, 0, time.UTC), cet},
+		{time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC), cest},
+		{time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC), cest},
+		{time.Date(2024, 10, 27, 0, 59, 59, 0, time.UTC), cest},
+		{time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC), cet},
+	}
+
+	for _, tt := range tests {
+		if got := meterZone(tt.t); got != tt.want {
+			t.Errorf("meterZone(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestMeterDate(t *testing.T) {
+	tests := []struct {
+		y    int
+		m    time.Month
+		d    int
+		want time.Time
+	}{
+		{2024, time.January, 15, time.Date(2024, 1, 14, 23, 0, 0, 0, time.UTC)},
+		{2024, time.March, 31, time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC)},
+		{2024, time.April, 1, time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC)},
+		{2024, time.October, 27, time.Date(2024, 10, 26, 22, 0, 0, 0, time.UTC)},
+		{2024, time.October, 28, time.Date(2024, 10, 27, 23, 0, 0, 0, time.UTC)},
+		{2024, time.December, 32, time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := meterDate(tt.y, tt.m, tt.d); !got.Equal(tt.want) {
+			t.Errorf("meterDate(%d, %d, %d) = %v, want %v", tt.y, tt.m, tt.d, got, tt.want)
+		}
+	}
+}